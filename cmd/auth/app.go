@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/metrics"
+	"github.com/ZiganshinDev/medods/internal/service"
+	"github.com/ZiganshinDev/medods/internal/storage/mongodb"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/exp/slog"
+)
+
+// app holds the dependencies shared by the commands that need storage.
+type app struct {
+	cfg *config.Config
+	log *slog.Logger
+
+	mongoClient  *mongo.Client
+	storage      *mongodb.Storage
+	metrics      *metrics.Metrics
+	auditRepo    *mongodb.AuditRepo
+	auditFile    *audit.FileSink
+	webhooks     *service.Webhooks
+	tokenManager *auth.Manager
+	keys         *service.Keys
+	authService  *service.Service
+	rbacService  *service.RBAC
+}
+
+func newApp(ctx context.Context, cfg *config.Config, log *slog.Logger) (*app, error) {
+	mongoClient, err := mongodb.NewClient(cfg.Mongo.URI, cfg.Mongo.User, cfg.Mongo.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init storage: %w", err)
+	}
+
+	a := &app{
+		cfg:         cfg,
+		log:         log,
+		mongoClient: mongoClient,
+		storage:     mongodb.NewStorage(mongoClient, cfg.Mongo.Database),
+	}
+
+	if cfg.Metrics.Enabled {
+		a.metrics = metrics.New()
+		a.storage.SetMetrics(a.metrics)
+	}
+
+	if err := a.init(ctx); err != nil {
+		a.close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *app) init(ctx context.Context) error {
+	// Rate limits, revoked tokens and codes expire through TTL indexes, so
+	// they cannot wait for someone to run migrate.
+	if _, err := a.storage.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	tokenManager, err := newTokenManager(a.cfg, a.log)
+	if err != nil {
+		return err
+	}
+	a.tokenManager = tokenManager
+
+	a.keys, err = service.NewKeys(a.storage.NewKeyRepo(), tokenManager, a.cfg.JWT.KeyEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to init signing keys: %w", err)
+	}
+
+	restored, err := a.keys.Restore(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore signing keys: %w", err)
+	}
+	if restored > 0 {
+		a.log.Info("restored rotated signing keys", slog.Int("count", restored))
+	}
+
+	a.authService, err = service.New(a.cfg, a.storage.NewRefreshRepo(), tokenManager, a.storage.NewDenylistRepo(), a.storage.NewLockRepo())
+	if err != nil {
+		return fmt.Errorf("failed to init service: %w", err)
+	}
+
+	a.authService.SetMetrics(a.metrics)
+
+	if a.cfg.Audit.Enabled {
+		auditor, err := a.newAuditor()
+		if err != nil {
+			return err
+		}
+
+		a.authService.SetAuditor(auditor)
+	}
+
+	if a.cfg.Webhooks.Enabled {
+		a.webhooks = service.NewWebhooks(a.cfg.Webhooks, a.storage.NewWebhookRepo(), a.log)
+
+		bus := service.NewEventBus()
+		bus.Subscribe(a.webhooks.Handle)
+		a.authService.SetEventBus(bus)
+	}
+
+	a.rbacService, err = service.NewRBAC(a.storage.NewRoleRepo())
+	if err != nil {
+		return fmt.Errorf("failed to init rbac service: %w", err)
+	}
+
+	// Requests without a tenant of their own get the default one, so that is
+	// where the assignments from the config apply.
+	bootstrapCtx, err := a.tenantContext(ctx, a.cfg.Tenancy.Default)
+	if err != nil {
+		return err
+	}
+
+	if err := a.rbacService.Bootstrap(bootstrapCtx, a.cfg.RBAC); err != nil {
+		return fmt.Errorf("failed to bootstrap roles: %w", err)
+	}
+
+	a.authService.AddClaimsEnricher(a.rbacService.Claims)
+
+	return nil
+}
+
+func (a *app) newAuditor() (*audit.Auditor, error) {
+	var sinks []audit.Sink
+
+	for _, name := range a.cfg.Audit.Sinks {
+		switch name {
+		case "mongo":
+			a.auditRepo = a.storage.NewAuditRepo()
+			sinks = append(sinks, a.auditRepo)
+		case "file":
+			sink, err := audit.NewFileSink(a.cfg.Audit.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open audit file: %w", err)
+			}
+			a.auditFile = sink
+			sinks = append(sinks, sink)
+		case "slog":
+			sinks = append(sinks, audit.NewSlogSink(a.log))
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+
+	return audit.New(sinks...), nil
+}
+
+func (a *app) close() {
+	a.webhooks.Close()
+
+	if a.auditFile != nil {
+		if err := a.auditFile.Close(); err != nil {
+			a.log.Error("failed to close audit file", sl.Err(err))
+		}
+	}
+
+	if err := a.mongoClient.Disconnect(context.Background()); err != nil {
+		a.log.Error("failed to stop mongo client", sl.Err(err))
+	}
+}
+
+// tenantContext returns ctx scoped to the tenant with the given id, or ctx
+// itself when id is empty.
+func (a *app) tenantContext(ctx context.Context, id string) (context.Context, error) {
+	if id == "" {
+		return ctx, nil
+	}
+
+	registry, err := tenant.NewRegistry(a.cfg.Tenancy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init tenants: %w", err)
+	}
+
+	t, ok := registry.Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrUnknownTenant, id)
+	}
+
+	return tenant.NewContext(ctx, t), nil
+}
+
+// newTokenManager builds the token manager with the ID token key and the
+// signing keys of the tenants. Rotated keys are restored by service.Keys.
+func newTokenManager(cfg *config.Config, log *slog.Logger) (*auth.Manager, error) {
+	idTokenKey, err := loadIDTokenKey(cfg.JWT.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load id token key: %w", err)
+	}
+	if cfg.JWT.PrivateKeyFile == "" {
+		log.Warn("JWT private key file is not set, using a generated key for ID tokens")
+	}
+
+	tokenManager, err := auth.New(cfg.JWT.SigningKey, idTokenKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init auth: %w", err)
+	}
+
+	tokenManager.Expect(cfg.JWT.Issuer, cfg.JWT.Audience)
+
+	for _, t := range cfg.Tenancy.Tenants {
+		if t.SigningKey == "" {
+			continue
+		}
+
+		if err := tokenManager.SetTenantKey(t.ID, t.SigningKey); err != nil {
+			return nil, fmt.Errorf("failed to set signing key of tenant %s: %w", t.ID, err)
+		}
+	}
+
+	return tokenManager, nil
+}
+
+func loadIDTokenKey(path string) (auth.Key, error) {
+	if path == "" {
+		return auth.GenerateKey()
+	}
+
+	return auth.LoadKey(path)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Env: envLocal,
+		JWT: config.JWT{
+			Issuer:     "https://auth.example.com",
+			SigningKey: "key",
+		},
+		Tenancy: config.Tenancy{
+			Default: "main",
+			Tenants: []config.Tenant{
+				{ID: "main"},
+				{ID: "clinic", SigningKey: "clinic-key"},
+			},
+		},
+	}
+}
+
+func TestTenantContext(t *testing.T) {
+	a := &app{cfg: testConfig()}
+	ctx := context.Background()
+
+	// Without -tenant the commands act outside of any tenant.
+	got, err := a.tenantContext(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "", tenant.ID(got))
+
+	got, err = a.tenantContext(ctx, "clinic")
+	require.NoError(t, err)
+	require.Equal(t, "clinic", tenant.ID(got))
+
+	_, err = a.tenantContext(ctx, "unknown")
+	require.ErrorIs(t, err, tenant.ErrUnknownTenant)
+}
+
+func TestNewTokenManager(t *testing.T) {
+	cfg := testConfig()
+
+	m, err := newTokenManager(cfg, setupLogger(cfg.Env, io.Discard))
+	require.NoError(t, err)
+
+	// Tokens of a tenant with its own key are signed with it.
+	token, err := m.NewJWT("alice", time.Minute, auth.WithIssuer(cfg.JWT.Issuer), auth.WithTenant("clinic"))
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "clinic", claims.TenantID)
+
+	other, err := auth.New("clinic-key")
+	require.NoError(t, err)
+	other.Expect(cfg.JWT.Issuer, "")
+
+	_, err = other.ParseJWT(token)
+	require.NoError(t, err)
+
+	// The configured issuer is expected.
+	token, err = m.NewJWT("alice", time.Minute, auth.WithIssuer("https://other.example.com"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(token)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	err = tokenInspect(cfg, setupLogger(cfg.Env, io.Discard), []string{token})
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+func keys(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errUsage("keys needs a subcommand")
+	}
+
+	switch args[0] {
+	case "generate":
+		return keysGenerate(args[1:])
+	case "rotate":
+		return keysRotate(cfg, log, args[1:])
+	case "list":
+		return keysList(cfg, log, args[1:])
+	}
+
+	return errUsage("unknown keys subcommand %q", args[0])
+}
+
+// keysGenerate writes a new RSA key in PEM form, suitable for jwt.private_key_file.
+func keysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write the key to instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	data := auth.EncodePrivateKeyPEM(key.Private)
+
+	if *out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(*out, data, 0o600); err != nil {
+		return err
+	}
+
+	fmt.Println(key.ID)
+
+	return nil
+}
+
+// keysRotate stores a new ID token signing key. Running servers pick it up
+// within jwt.key_reload_interval. Access token keys are not rotated this way.
+func keysRotate(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) > 0 {
+		return errUsage("keys rotate takes no arguments")
+	}
+
+	ctx := context.Background()
+
+	a, err := newApp(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	key, err := a.keys.Rotate(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(key.ID)
+
+	return nil
+}
+
+func keysList(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) > 0 {
+		return errUsage("keys list takes no arguments")
+	}
+
+	a, err := newApp(context.Background(), cfg, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tCREATED\tACTIVE")
+	for i, key := range a.tokenManager.IDTokenKeys() {
+		fmt.Fprintf(w, "%s\t%s\t%t\n", key.ID, key.CreatedAt.Format(time.RFC3339), i == 0)
+	}
+
+	return w.Flush()
+}
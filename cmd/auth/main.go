@@ -1,23 +1,12 @@
 package main
 
 import (
-	"context"
-	"errors"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	"github.com/ZiganshinDev/medods/internal/auth"
 	"github.com/ZiganshinDev/medods/internal/config"
-	"github.com/ZiganshinDev/medods/internal/http-server/handler"
-	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
-	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
-	"github.com/ZiganshinDev/medods/internal/server"
-	"github.com/ZiganshinDev/medods/internal/service"
-	"github.com/ZiganshinDev/medods/internal/storage/mongodb"
 	"github.com/joho/godotenv"
 	"golang.org/x/exp/slog"
 )
@@ -28,94 +17,90 @@ const (
 	envProd  = "prod"
 )
 
+const usage = `Usage: auth <command> [arguments]
+
+Commands:
+  serve                                   start the HTTP server (default)
+  migrate                                 create the MongoDB indexes, also done on start
+  keys generate [-out file]               generate an RSA key for jwt.private_key_file
+  keys rotate                             add a new ID token signing key
+  keys list                               list the ID token signing keys
+  sessions list [-tenant id] <user>       list the refresh sessions of a user
+  sessions revoke [-tenant id] [-id session] <user>
+                                          revoke one or all sessions of a user
+  token mint -sub <subject> [flags]       issue an access token
+  token inspect <jwt>                     verify an access token and print its claims
+`
+
+// command runs a subcommand. Errors are reported by main.
+type command func(cfg *config.Config, log *slog.Logger, args []string) error
+
+var commands = map[string]command{
+	"serve":    serve,
+	"migrate":  migrate,
+	"keys":     keys,
+	"sessions": sessions,
+	"token":    token,
+}
+
 func main() {
 	err := godotenv.Load("config.env")
 	if err != nil {
 		log.Fatal("error loading .env file")
 	}
 
-	cfg := config.MustLoad()
-
-	log := setupLogger(cfg.Env)
-
-	log.Info(
-		"Starting AuthApp",
-		slog.String("env", cfg.Env))
-	log.Debug("debug messages are enabled")
-
-	mongoClient, err := mongodb.NewClient(cfg.Mongo.URI, cfg.Mongo.User, cfg.Mongo.Password)
-	if err != nil {
-		log.Error("failed to init storage", sl.Err(err))
-		os.Exit(1)
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
 
-	mongoDatabase := mongodb.NewStorage(mongoClient, cfg.Mongo.Database)
-	mongoRefreshRepo := mongoDatabase.NewRefreshRepo()
-
-	tokenManager, err := auth.New(cfg.JWT.SigningKey)
-	if err != nil {
-		log.Error("failed to init auth", sl.Err(err))
-		os.Exit(1)
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
 	}
 
-	service, err := service.New(cfg, mongoRefreshRepo, tokenManager)
-	if err != nil {
-		log.Error("failed to init service", sl.Err(err))
-		os.Exit(1)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
 	}
 
-	logger := logger.Log
-
-	h := handler.New(cfg, service, logger)
-
-	srv := server.New(cfg, h.NewRouter())
-
-	go func() {
-		if err := srv.Run(); !errors.Is(err, http.ErrServerClosed) {
-			log.Error("failed to init http server", sl.Err(err))
-			os.Exit(1)
-		}
-	}()
-
-	log.Info("Server started")
-
-	// Graceful Shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-
-	<-quit
+	cfg := config.MustLoad()
 
-	const timeout = 5 * time.Second
+	// Only the server logs to stdout, the other commands print their results there.
+	var out io.Writer = os.Stderr
+	if name == "serve" {
+		out = os.Stdout
+	}
 
-	ctx, shutdown := context.WithTimeout(context.Background(), timeout)
-	defer shutdown()
+	log := setupLogger(cfg.Env, out)
 
-	if err := srv.Stop(ctx); err != nil {
-		log.Error("failed to stop server", sl.Err(err))
+	if err := cmd(cfg, log, args); err != nil {
+		fmt.Fprintf(os.Stderr, "auth %s: %v\n", name, err)
 		os.Exit(1)
 	}
+}
 
-	if err := mongoClient.Disconnect(context.Background()); err != nil {
-		log.Error("failed to stop mongo client", sl.Err(err))
-		os.Exit(1)
-	}
+// errUsage makes main print the usage of a command instead of a bare error.
+func errUsage(format string, args ...interface{}) error {
+	return fmt.Errorf("%s\n\n%s", fmt.Sprintf(format, args...), usage)
 }
 
-func setupLogger(env string) *slog.Logger {
+func setupLogger(env string, w io.Writer) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
 	case envLocal:
 		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
 	case envDev:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
 	case envProd:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
+			slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}),
 		)
 	}
 
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommandArguments runs the commands with arguments they must refuse
+// before connecting to the database.
+func TestCommandArguments(t *testing.T) {
+	cfg := &config.Config{Env: envLocal}
+	log := setupLogger(cfg.Env, io.Discard)
+
+	tests := []struct {
+		name string
+		cmd  command
+		args []string
+		want string
+	}{
+		{name: "serve", cmd: serve, args: []string{"now"}, want: "serve takes no arguments"},
+		{name: "migrate", cmd: migrate, args: []string{"now"}, want: "migrate takes no arguments"},
+		{name: "keys", cmd: keys, want: "keys needs a subcommand"},
+		{name: "keys unknown", cmd: keys, args: []string{"delete"}, want: `unknown keys subcommand "delete"`},
+		{name: "keys rotate", cmd: keys, args: []string{"rotate", "now"}, want: "keys rotate takes no arguments"},
+		{name: "keys list", cmd: keys, args: []string{"list", "all"}, want: "keys list takes no arguments"},
+		{name: "sessions", cmd: sessions, want: "sessions needs a subcommand"},
+		{name: "sessions unknown", cmd: sessions, args: []string{"show"}, want: `unknown sessions subcommand "show"`},
+		{name: "sessions list", cmd: sessions, args: []string{"list", "-tenant", "main"}, want: "sessions list needs a user name"},
+		{name: "sessions list users", cmd: sessions, args: []string{"list", "alice", "bob"}, want: "sessions list needs a user name"},
+		{name: "sessions revoke", cmd: sessions, args: []string{"revoke", "-id", "1"}, want: "sessions revoke needs a user name"},
+		{name: "sessions revoke flag", cmd: sessions, args: []string{"revoke", "-all", "alice"}, want: "flag provided but not defined: -all"},
+		{name: "token", cmd: token, want: "token needs a subcommand"},
+		{name: "token unknown", cmd: token, args: []string{"sign"}, want: `unknown token subcommand "sign"`},
+		{name: "token mint", cmd: token, args: []string{"mint", "-scope", "profile"}, want: "token mint needs -sub and no arguments"},
+		{name: "token mint extra", cmd: token, args: []string{"mint", "-sub", "alice", "bob"}, want: "token mint needs -sub and no arguments"},
+		{name: "token mint ttl", cmd: token, args: []string{"mint", "-sub", "alice", "-ttl", "soon"}, want: `invalid value "soon" for flag -ttl`},
+		{name: "token inspect", cmd: token, args: []string{"inspect"}, want: "token inspect needs a token"},
+	}
+
+	for _, tt := range tests {
+		err := tt.cmd(cfg, log, tt.args)
+		require.ErrorContains(t, err, tt.want, tt.name)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/storage/mongodb"
+	"golang.org/x/exp/slog"
+)
+
+// migrate creates the MongoDB indexes. It does not need the signing keys, so
+// it only connects to the database.
+func migrate(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) > 0 {
+		return errUsage("migrate takes no arguments")
+	}
+
+	mongoClient, err := mongodb.NewClient(cfg.Mongo.URI, cfg.Mongo.User, cfg.Mongo.Password)
+	if err != nil {
+		return fmt.Errorf("failed to init storage: %w", err)
+	}
+
+	indexes, err := mongodb.NewStorage(mongoClient, cfg.Mongo.Database).Migrate(context.Background())
+	if disconnectErr := mongoClient.Disconnect(context.Background()); disconnectErr != nil {
+		log.Error("failed to stop mongo client", sl.Err(disconnectErr))
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(indexes)
+	for _, idx := range indexes {
+		fmt.Println(idx)
+	}
+
+	log.Info("migration finished", slog.Int("indexes", len(indexes)))
+
+	return nil
+}
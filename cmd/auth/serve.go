@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/dpop"
+	"github.com/ZiganshinDev/medods/internal/health"
+	"github.com/ZiganshinDev/medods/internal/http-server/handler"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/ratelimit"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/tenancy"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/policy"
+	"github.com/ZiganshinDev/medods/internal/server"
+	"github.com/ZiganshinDev/medods/internal/service"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/ZiganshinDev/medods/internal/tracing"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"golang.org/x/exp/slog"
+)
+
+func serve(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) > 0 {
+		return errUsage("serve takes no arguments")
+	}
+
+	log.Info(
+		"Starting AuthApp",
+		slog.String("env", cfg.Env))
+	log.Debug("debug messages are enabled")
+
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("failed to init tracing: %w", err)
+		}
+
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				log.Error("failed to flush traces", sl.Err(err))
+			}
+		}()
+	}
+
+	a, err := newApp(context.Background(), cfg, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	// A key rotated on another instance is picked up without a restart.
+	if cfg.JWT.KeyReloadInterval > 0 {
+		watchCtx, stopWatching := context.WithCancel(logctx.NewContext(context.Background(), log))
+		defer stopWatching()
+
+		go a.keys.Watch(watchCtx, cfg.JWT.KeyReloadInterval)
+	}
+
+	resumed, err := a.webhooks.Resume(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to resume webhook deliveries: %w", err)
+	}
+	if resumed > 0 {
+		log.Info("resumed webhook deliveries", slog.Int("count", resumed))
+	}
+
+	oauthService, err := service.NewOAuth(cfg, a.storage.NewClientRepo(), a.storage.NewCodeRepo(), a.storage.NewDeviceRepo(), a.tokenManager, a.authService)
+	if err != nil {
+		return fmt.Errorf("failed to init oauth service: %w", err)
+	}
+
+	if err := oauthService.RegisterClients(context.Background(), cfg.OAuth.Clients); err != nil {
+		return fmt.Errorf("failed to register oauth clients: %w", err)
+	}
+
+	policyEngine, err := policy.NewFromConfig(cfg.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to init policy engine: %w", err)
+	}
+
+	handlerOpts := []handler.Option{handler.WithOAuth(oauthService), handler.WithRBAC(a.rbacService), handler.WithPolicy(policyEngine), handler.WithAdmin(a.authService, a.keys)}
+
+	if cfg.RateLimit.Enabled {
+		var store ratelimit.Store = ratelimit.NewMemoryStore()
+		if cfg.RateLimit.Store == "mongo" {
+			store = a.storage.NewRateLimitRepo()
+		}
+
+		limiter, err := ratelimit.New(cfg.RateLimit, store)
+		if err != nil {
+			return fmt.Errorf("failed to init rate limiter: %w", err)
+		}
+
+		handlerOpts = append(handlerOpts, handler.WithRateLimiter(limiter))
+	}
+
+	if cfg.DPoP.Enabled {
+		var cache dpop.ReplayCache = dpop.NewMemoryCache()
+		if cfg.DPoP.Store == "mongo" {
+			cache = a.storage.NewDPoPRepo()
+		}
+
+		handlerOpts = append(handlerOpts, handler.WithDPoP(dpop.NewVerifier(cache, cfg.DPoP.ProofLifetime)))
+	}
+
+	if a.auditRepo != nil {
+		handlerOpts = append(handlerOpts, handler.WithAudit(a.auditRepo))
+	}
+
+	if a.metrics != nil {
+		handlerOpts = append(handlerOpts, handler.WithMetrics(a.metrics))
+	}
+
+	if len(cfg.Tenancy.Tenants) > 0 {
+		registry, err := tenant.NewRegistry(cfg.Tenancy)
+		if err != nil {
+			return fmt.Errorf("failed to init tenants: %w", err)
+		}
+
+		handlerOpts = append(handlerOpts, handler.WithTenancy(tenancy.New(registry)))
+	}
+
+	checker := health.New()
+	checker.Add("mongo", func(ctx context.Context) error {
+		return a.mongoClient.Ping(ctx, readpref.Primary())
+	})
+	checker.Add("signing_keys", func(ctx context.Context) error {
+		return a.tokenManager.CheckKeys()
+	})
+
+	handlerOpts = append(handlerOpts, handler.WithHealth(checker))
+
+	h := handler.New(cfg, a.authService, logger.New(log), handlerOpts...)
+
+	srv, err := server.New(cfg, h.NewRouter(), server.WithDrainer(checker), server.WithLogger(log))
+	if err != nil {
+		return fmt.Errorf("failed to init http server: %w", err)
+	}
+
+	go func() {
+		if err := srv.Run(); !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to init http server", sl.Err(err))
+			os.Exit(1)
+		}
+	}()
+
+	log.Info("Server started", slog.String("address", cfg.HTTPServer.Address), slog.Bool("tls", cfg.HTTPServer.TLS.Enabled))
+
+	// Graceful Shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+
+	<-quit
+
+	// Connections get the same time to finish once draining is over.
+	timeout := cfg.HTTPServer.DrainDelay + 5*time.Second
+
+	ctx, shutdown := context.WithTimeout(context.Background(), timeout)
+	defer shutdown()
+
+	if err := srv.Stop(ctx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+func sessions(cfg *config.Config, log *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errUsage("sessions needs a subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		return sessionsList(cfg, log, args[1:])
+	case "revoke":
+		return sessionsRevoke(cfg, log, args[1:])
+	}
+
+	return errUsage("unknown sessions subcommand %q", args[0])
+}
+
+func sessionsList(cfg *config.Config, log *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	tenantID := fs.String("tenant", "", "tenant of the user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage("sessions list needs a user name")
+	}
+
+	a, err := newApp(context.Background(), cfg, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	ctx, err := a.tenantContext(context.Background(), *tenantID)
+	if err != nil {
+		return err
+	}
+
+	list, err := a.authService.Sessions(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tSCOPE\tCREATED\tEXPIRES")
+	for _, s := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, s.ClientID, s.Scope, s.CreatedTime.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+// sessionsRevoke ends one session of a user with -id, or all of them.
+func sessionsRevoke(cfg *config.Config, log *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet("sessions revoke", flag.ContinueOnError)
+	tenantID := fs.String("tenant", "", "tenant of the user")
+	id := fs.String("id", "", "session to revoke, all sessions if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage("sessions revoke needs a user name")
+	}
+
+	a, err := newApp(context.Background(), cfg, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	ctx, err := a.tenantContext(context.Background(), *tenantID)
+	if err != nil {
+		return err
+	}
+
+	return a.authService.RevokeSessions(audit.WithActor(ctx, "cli"), fs.Arg(0), *id)
+}
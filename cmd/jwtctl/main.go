@@ -0,0 +1,240 @@
+// Command jwtctl decodes and verifies JWTs offline, so tokens never have to be
+// pasted into websites.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+)
+
+const usage = `Usage: jwtctl <command> [flags] [jwt]
+
+Commands:
+  decode                  print the header and claims without verifying
+  verify [flags]          verify the token and explain why it fails
+
+Verify flags:
+  -key -                  read the HMAC secret of access tokens from stdin
+  -key-file file          RSA key in PEM form, or a file with the HMAC secret
+  -jwks file              JWKS document, as served at /.well-known/jwks.json
+  -aud string             expected audience
+  -iss string             expected issuer
+  -at time                verify at this RFC 3339 time instead of now
+
+The token is read from stdin when it is not given, which keeps it out of the
+shell history. With -key - the secret is the first line of stdin and the
+token the next one. -key also takes the secret itself, but other users can
+see it in the process list.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	in := bufio.NewReader(stdin)
+
+	var err error
+
+	switch args[0] {
+	case "decode":
+		err = decode(args[1:], in, stdout)
+	case "verify":
+		err = verify(args[1:], in, stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtctl: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func decode(args []string, in *bufio.Reader, out io.Writer) error {
+	token, err := readToken(args, in)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := auth.Decode(token)
+	if err != nil {
+		return explain(err)
+	}
+
+	return printJSON(out, decoded)
+}
+
+func verify(args []string, in *bufio.Reader, out, errOut io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	key := fs.String("key", "", "HMAC secret, or - to read it from stdin")
+	keyFile := fs.String("key-file", "", "RSA key in PEM form or HMAC secret file")
+	jwksFile := fs.String("jwks", "", "JWKS file")
+	aud := fs.String("aud", "", "expected audience")
+	iss := fs.String("iss", "", "expected issuer")
+	at := fs.String("at", "", "RFC 3339 time to verify at")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := auth.VerifyOptions{Secret: []byte(*key), Audience: *aud, Issuer: *iss}
+
+	if *key == "-" {
+		secret, err := readLine(in)
+		if err != nil {
+			return fmt.Errorf("reading key from stdin: %w", err)
+		}
+		if secret == "" {
+			return errors.New("the key read from stdin is empty")
+		}
+		opts.Secret = []byte(secret)
+	}
+
+	if *keyFile != "" {
+		if err := loadKeyFile(*keyFile, &opts); err != nil {
+			return err
+		}
+	}
+
+	if *jwksFile != "" {
+		jwks, err := loadJWKS(*jwksFile)
+		if err != nil {
+			return err
+		}
+		opts.JWKS = jwks
+	}
+
+	if len(opts.Secret) == 0 && opts.JWKS == nil {
+		return errors.New("verify needs -key, -key-file or -jwks")
+	}
+
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("invalid -at: %w", err)
+		}
+		opts.Now = t
+	}
+
+	token, err := readToken(fs.Args(), in)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := auth.Verify(token, opts)
+	if decoded != nil {
+		if err := printJSON(out, decoded); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return explain(err)
+	}
+
+	fmt.Fprintln(errOut, "token is valid")
+
+	return nil
+}
+
+// loadKeyFile treats a PEM file as an RSA key and anything else as an HMAC secret.
+func loadKeyFile(path string, opts *auth.VerifyOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(string(data), "-----BEGIN") {
+		opts.Secret = []byte(strings.TrimSpace(string(data)))
+		return nil
+	}
+
+	public, err := auth.ParsePublicKeyPEM(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	jwk := auth.PublicJWK("", public)
+	opts.JWKS = &auth.JWKS{Keys: []auth.JWK{jwk}}
+
+	return nil
+}
+
+func loadJWKS(path string) (*auth.JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks auth.JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &jwks, nil
+}
+
+func readToken(args []string, in *bufio.Reader) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("expected one token, got %d arguments", len(args))
+	}
+
+	if len(args) == 1 && args[0] != "-" {
+		return args[0], nil
+	}
+
+	token, err := readLine(in)
+	if err != nil {
+		return "", fmt.Errorf("reading token from stdin: %w", err)
+	}
+
+	return token, nil
+}
+
+// readLine reads the next line of in, which may lack a newline at the end.
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// explain reduces a verification error to its reason and detail.
+func explain(err error) error {
+	var verr *auth.VerificationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+
+	return err
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func newToken(t *testing.T, secret string) string {
+	m, err := auth.New(secret)
+	require.NoError(t, err)
+
+	token, err := m.NewJWT("alice", time.Hour)
+	require.NoError(t, err)
+
+	return token
+}
+
+func runJWTCtl(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestVerifyKeyFromStdin(t *testing.T) {
+	token := newToken(t, "secret")
+
+	code, stdout, stderr := runJWTCtl("secret\n"+token+"\n", "verify", "-key", "-")
+	require.Equal(t, 0, code, stderr)
+	require.Contains(t, stdout, `"sub": "alice"`)
+	require.Equal(t, "token is valid\n", stderr)
+
+	code, _, stderr = runJWTCtl("other\n"+token+"\n", "verify", "-key", "-")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "jwtctl: ")
+
+	code, _, stderr = runJWTCtl("", "verify", "-key", "-", token)
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "reading key from stdin")
+}
+
+func TestVerifyKeyFile(t *testing.T) {
+	token := newToken(t, "secret")
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+
+	code, stdout, stderr := runJWTCtl("", "verify", "-key-file", path, token)
+	require.Equal(t, 0, code, stderr)
+	require.Contains(t, stdout, `"sub": "alice"`)
+
+	code, _, stderr = runJWTCtl(token, "verify")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "verify needs -key, -key-file or -jwks")
+}
+
+func TestDecode(t *testing.T) {
+	token := newToken(t, "secret")
+
+	code, stdout, stderr := runJWTCtl(token, "decode")
+	require.Equal(t, 0, code, stderr)
+	require.Contains(t, stdout, `"alg": "HS512"`)
+
+	code, _, stderr = runJWTCtl("", "decode", "a", "b")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "expected one token, got 2 arguments")
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := runJWTCtl("")
+	require.Equal(t, 2, code)
+	require.Equal(t, usage, stderr)
+
+	code, _, stderr = runJWTCtl("", "sign")
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr, `unknown command "sign"`)
+
+	code, stdout, _ := runJWTCtl("", "help")
+	require.Equal(t, 0, code)
+	require.Equal(t, usage, stdout)
+}
@@ -0,0 +1,140 @@
+// Package audit records security relevant events, such as sign-ins,
+// refreshes and revocations, to one or more sinks.
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"golang.org/x/exp/slog"
+)
+
+// Event types.
+const (
+	Login            = "login"
+	Refresh          = "refresh"
+	Revoke           = "revoke"
+	ValidationFailed = "validation_failed"
+	Lock             = "lock"
+	Unlock           = "unlock"
+	TokenExchange    = "token_exchange"
+)
+
+// Outcomes.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+type Sink interface {
+	Write(ctx context.Context, event models.AuditEvent) error
+}
+
+// Auditor writes events to all of its sinks. A nil *Auditor records nothing.
+type Auditor struct {
+	sinks []Sink
+}
+
+func New(sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+// Record fills in the time, tenant, request ID and client of ctx and writes
+// event to every sink. The actor defaults to the one in ctx, then to the
+// subject. A failing sink is logged and does not stop the others, nor the
+// operation being audited. Sinks are not canceled with ctx.
+func (a *Auditor) Record(ctx context.Context, event models.AuditEvent) {
+	if a == nil {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	event.TenantID = tenant.ID(ctx)
+	event.RequestID = logctx.RequestID(ctx)
+
+	if c, ok := ctx.Value(clientKey{}).(client); ok {
+		event.IP = c.ip
+		event.UserAgent = c.userAgent
+	}
+
+	if event.Actor == "" {
+		event.Actor = actor(ctx)
+	}
+	if event.Actor == "" {
+		event.Actor = event.Subject
+	}
+
+	if event.Outcome == "" {
+		event.Outcome = Success
+	}
+
+	for _, sink := range a.sinks {
+		if err := write(ctx, sink, event); err != nil {
+			logctx.FromContext(ctx).Error("failed to write audit event", slog.String("type", event.Type), sl.Err(err))
+		}
+	}
+}
+
+// writeTimeout bounds how long a sink may take to write an event.
+const writeTimeout = 5 * time.Second
+
+// write writes event to sink even if ctx is canceled, such as when the client
+// of the request being audited goes away, since the event happened anyway.
+func write(ctx context.Context, sink Sink, event models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(detached{ctx}, writeTimeout)
+	defer cancel()
+
+	return sink.Write(ctx, event)
+}
+
+// detached has the values of its parent, but not its deadline or cancelation.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+type (
+	clientKey struct{}
+	actorKey  struct{}
+)
+
+type client struct {
+	ip        string
+	userAgent string
+}
+
+// Middleware puts the IP and user agent of the caller in the request context
+// for Record.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		ctx := context.WithValue(r.Context(), clientKey{}, client{ip: ip, userAgent: r.UserAgent()})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithActor records who performs the operations in ctx, when it is not the
+// subject itself, such as an operator using the admin API.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actor(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
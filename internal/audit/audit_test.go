@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+type sinkFunc func(ctx context.Context, event models.AuditEvent) error
+
+func (f sinkFunc) Write(ctx context.Context, event models.AuditEvent) error {
+	return f(ctx, event)
+}
+
+func TestRecord(t *testing.T) {
+	var got []models.AuditEvent
+	failing := sinkFunc(func(ctx context.Context, event models.AuditEvent) error {
+		return errors.New("sink is down")
+	})
+	recording := sinkFunc(func(ctx context.Context, event models.AuditEvent) error {
+		got = append(got, event)
+		return nil
+	})
+
+	a := New(failing, recording)
+
+	var ctx context.Context
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	req := httptest.NewRequest("GET", "/auth", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("User-Agent", "curl")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	a.Record(ctx, models.AuditEvent{Type: Login, Subject: "alice"})
+	a.Record(WithActor(ctx, "cert:ops"), models.AuditEvent{Type: Lock, Subject: "bob"})
+
+	require.Len(t, got, 2)
+	require.Equal(t, Success, got[0].Outcome)
+	require.Equal(t, "alice", got[0].Actor)
+	require.Equal(t, "10.0.0.1", got[0].IP)
+	require.Equal(t, "curl", got[0].UserAgent)
+	require.Equal(t, "req-1", got[0].RequestID)
+	require.False(t, got[0].Time.IsZero())
+	require.Equal(t, "cert:ops", got[1].Actor)
+
+	var nilAuditor *Auditor
+	nilAuditor.Record(ctx, models.AuditEvent{Type: Login})
+}
+
+func TestRecordOutlivesRequest(t *testing.T) {
+	var (
+		err       error
+		requestID string
+	)
+	a := New(sinkFunc(func(ctx context.Context, event models.AuditEvent) error {
+		err = ctx.Err()
+		requestID = logctx.RequestID(ctx)
+
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(logctx.WithRequestID(context.Background(), "req-1"))
+	cancel()
+
+	a.Record(ctx, models.AuditEvent{Type: Login, Subject: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, "req-1", requestID)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(context.Background(), models.AuditEvent{Type: Login, Subject: "alice"}))
+	require.NoError(t, sink.Write(context.Background(), models.AuditEvent{Type: Refresh, Subject: "alice"}))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		types = append(types, event.Type)
+	}
+
+	require.Equal(t, []string{Login, Refresh}, types)
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"golang.org/x/exp/slog"
+)
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	const op = "audit.NewFileSink"
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, event models.AuditEvent) error {
+	const op = "audit.FileSink.Write"
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// SlogSink logs events at level Info, with the message "audit".
+type SlogSink struct {
+	log *slog.Logger
+}
+
+func NewSlogSink(log *slog.Logger) *SlogSink {
+	return &SlogSink{log: log}
+}
+
+func (s *SlogSink) Write(ctx context.Context, event models.AuditEvent) error {
+	attrs := []slog.Attr{
+		slog.String("type", event.Type),
+		slog.String("outcome", event.Outcome),
+		slog.Time("time", event.Time),
+	}
+
+	optional := []struct{ key, value string }{
+		{"reason", event.Reason},
+		{"actor", event.Actor},
+		{"subject", event.Subject},
+		{"tenant_id", event.TenantID},
+		{"session_id", event.SessionID},
+		{"client_id", event.ClientID},
+		{"ip", event.IP},
+		{"user_agent", event.UserAgent},
+		{"request_id", event.RequestID},
+	}
+	for _, a := range optional {
+		if a.value != "" {
+			attrs = append(attrs, slog.String(a.key, a.value))
+		}
+	}
+
+	s.log.LogAttrs(ctx, slog.LevelInfo, "audit", slog.Group("event", attrsToAny(attrs)...))
+
+	return nil
+}
+
+func attrsToAny(attrs []slog.Attr) []interface{} {
+	args := make([]interface{}, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+
+	return args
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type CustomClaims struct {
+	jwt.StandardClaims
+	GUID        string   `json:"guid"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	TenantID    string   `json:"tid,omitempty"`
+	AuthTime    int64    `json:"auth_time,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Act         *Actor   `json:"act,omitempty"`
+	// ImpersonatedBy is the client that obtained the token by impersonating
+	// its subject with a token exchange.
+	ImpersonatedBy string        `json:"impersonated_by,omitempty"`
+	Cnf            *Confirmation `json:"cnf,omitempty"`
+
+	// Extra holds custom claims. They are written at the top level of the
+	// payload and never replace the claims above.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Machine reports whether the token was issued to a client acting on its own
+// behalf, as the client credentials grant does. Such a token is not a user
+// session.
+func (c *CustomClaims) Machine() bool {
+	return c.ClientID != "" && c.ClientID == c.Subject
+}
+
+// AuthenticatedAt is when the user authenticated, or zero if the token does
+// not say.
+func (c *CustomClaims) AuthenticatedAt() time.Time {
+	if c.AuthTime == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(c.AuthTime, 0)
+}
+
+// Actor is the RFC 8693 act claim. A nested Act records earlier delegations.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// registeredClaims are the payload members backed by CustomClaims fields.
+var registeredClaims = map[string]struct{}{
+	"aud": {}, "exp": {}, "jti": {}, "iat": {}, "iss": {}, "nbf": {}, "sub": {},
+	"guid": {}, "scope": {}, "client_id": {}, "roles": {}, "permissions": {}, "act": {}, "tid": {}, "cnf": {},
+	"auth_time": {}, "impersonated_by": {},
+}
+
+// claimsAlias has the fields of CustomClaims without its JSON methods.
+type claimsAlias CustomClaims
+
+func (c CustomClaims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claimsAlias(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	payload := make(map[string]interface{}, len(c.Extra))
+	for k, v := range c.Extra {
+		if _, ok := registeredClaims[k]; !ok {
+			payload[k] = v
+		}
+	}
+
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(payload)
+}
+
+func (c *CustomClaims) UnmarshalJSON(data []byte) error {
+	var alias claimsAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	for k := range registeredClaims {
+		delete(payload, k)
+	}
+
+	alias.Extra = nil
+	if len(payload) > 0 {
+		alias.Extra = payload
+	}
+
+	*c = CustomClaims(alias)
+
+	return nil
+}
+
+// ClaimsOption sets claims of an access token. Options are applied in order,
+// so a later option overrides an earlier one.
+type ClaimsOption func(*CustomClaims)
+
+func WithScope(scope string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Scope = scope
+	}
+}
+
+func WithClientID(clientID string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.ClientID = clientID
+	}
+}
+
+func WithTenant(tenantID string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.TenantID = tenantID
+	}
+}
+
+// WithAuthTime records when the user authenticated. A zero t leaves it out.
+func WithAuthTime(t time.Time) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.AuthTime = 0
+		if !t.IsZero() {
+			c.AuthTime = t.Unix()
+		}
+	}
+}
+
+func WithIssuer(issuer string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Issuer = issuer
+	}
+}
+
+func WithAudience(audience string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Audience = audience
+	}
+}
+
+func WithRoles(roles ...string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Roles = roles
+	}
+}
+
+func WithPermissions(permissions ...string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Permissions = permissions
+	}
+}
+
+func WithActor(actor *Actor) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.Act = actor
+	}
+}
+
+// WithImpersonator marks the token as obtained by clientID impersonating its
+// subject.
+func WithImpersonator(clientID string) ClaimsOption {
+	return func(c *CustomClaims) {
+		c.ImpersonatedBy = clientID
+	}
+}
+
+// WithClaim sets a custom claim. Names of registered claims are ignored.
+func WithClaim(name string, value interface{}) ClaimsOption {
+	return func(c *CustomClaims) {
+		if _, ok := registeredClaims[name]; ok {
+			return
+		}
+
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[name] = value
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// Confirmation is the cnf claim of a sender-constrained access token. Only a
+// client holding the confirmed key may use the token.
+type Confirmation struct {
+	// X5tS256 is the certificate thumbprint of RFC 8705 section 3.1.
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	// JKT is the JWK thumbprint of the DPoP key of RFC 9449 section 6.1.
+	JKT string `json:"jkt,omitempty"`
+}
+
+func (c Confirmation) empty() bool {
+	return c == Confirmation{}
+}
+
+// WithConfirmation binds the token to c. An empty confirmation leaves the
+// token unbound.
+func WithConfirmation(c Confirmation) ClaimsOption {
+	return func(claims *CustomClaims) {
+		if c.empty() {
+			claims.Cnf = nil
+			return
+		}
+
+		claims.Cnf = &c
+	}
+}
+
+// CertificateThumbprint is the base64url SHA-256 hash of the DER encoding of
+// cert, as used in the x5t#S256 confirmation.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type confirmationKey struct{}
+
+// NewConfirmationContext returns ctx carrying the key material the caller
+// has proven to hold, so that tokens issued within ctx are bound to it.
+func NewConfirmationContext(ctx context.Context, c Confirmation) context.Context {
+	return context.WithValue(ctx, confirmationKey{}, c)
+}
+
+func ConfirmationFromContext(ctx context.Context) (Confirmation, bool) {
+	c, ok := ctx.Value(confirmationKey{}).(Confirmation)
+	return c, ok && !c.empty()
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type IDTokenClaims struct {
+	jwt.StandardClaims
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+}
+
+func (m *Manager) NewIDToken(claims IDTokenClaims) (string, error) {
+	const op = "auth.idtoken.NewIDToken"
+
+	if m.keys == nil {
+		return "", fmt.Errorf("%s: %w", op, ErrNoKey)
+	}
+
+	key, err := m.keys.Active()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return signed, nil
+}
+
+func (m *Manager) JWKS() JWKS {
+	if m.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+
+	return m.keys.JWKS()
+}
+
+// IDTokenKeys returns the ID token keys, the signing key first.
+func (m *Manager) IDTokenKeys() []Key {
+	return m.keys.Keys()
+}
+
+// CheckKeys returns ErrNoKey when there is no ID token signing key.
+func (m *Manager) CheckKeys() error {
+	_, err := m.keys.Active()
+	return err
+}
+
+// RotateKey makes key the ID token signing key. Tokens signed with earlier
+// keys stay verifiable through the JWKS.
+func (m *Manager) RotateKey(key Key) {
+	m.keys.Rotate(key)
+}
+
+// SetIDTokenKeys replaces the ID token keys. The first one signs.
+func (m *Manager) SetIDTokenKeys(keys ...Key) {
+	m.keys.Replace(keys)
+}
+
+// AccessTokenHash computes the at_hash claim for an RS256 ID token: the left
+// half of the SHA-256 of the access token, base64url encoded.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
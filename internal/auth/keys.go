@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AlgRS256 = "RS256"
+
+	rsaKeyBits = 2048
+
+	// MaxKeys is how many keys a KeySet keeps, the active one included.
+	MaxKeys = 3
+)
+
+var ErrNoKey = errors.New("no signing key")
+
+type Key struct {
+	ID        string
+	Private   *rsa.PrivateKey
+	CreatedAt time.Time
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func GenerateKey() (Key, error) {
+	const op = "auth.keys.GenerateKey"
+
+	private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return NewKey(private), nil
+}
+
+func NewKey(private *rsa.PrivateKey) Key {
+	return Key{
+		ID:        Thumbprint(&private.PublicKey),
+		Private:   private,
+		CreatedAt: time.Now(),
+	}
+}
+
+// LoadKey reads an RSA private key in PKCS#1 or PKCS#8 PEM form.
+func LoadKey(path string) (Key, error) {
+	const op = "auth.keys.LoadKey"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	private, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return NewKey(private), nil
+}
+
+func ParsePrivateKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+
+	return private, nil
+}
+
+// ParsePublicKeyPEM reads an RSA public key in PKIX or PKCS#1 PEM form, or
+// the public half of a private key.
+func ParsePublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("not an RSA public key")
+		}
+
+		return public, nil
+	}
+
+	private, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &private.PublicKey, nil
+}
+
+func EncodePrivateKeyPEM(private *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(private),
+	})
+}
+
+// EncryptPrivateKey seals a private key with AES-256-GCM under a key derived
+// from secret, for storage out of the process. kid is authenticated with it,
+// so a sealed key cannot be passed off as another.
+func EncryptPrivateKey(private *rsa.PrivateKey, secret string, kid string) ([]byte, error) {
+	const op = "auth.keys.EncryptPrivateKey"
+
+	aead, err := keyEncryption(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return aead.Seal(nonce, nonce, x509.MarshalPKCS1PrivateKey(private), []byte(kid)), nil
+}
+
+// DecryptPrivateKey opens a key sealed by EncryptPrivateKey.
+func DecryptPrivateKey(sealed []byte, secret string, kid string) (*rsa.PrivateKey, error) {
+	const op = "auth.keys.DecryptPrivateKey"
+
+	aead, err := keyEncryption(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("sealed key is too short"))
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	der, err := aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	private, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return private, nil
+}
+
+func keyEncryption(secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("empty key encryption key")
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func PublicJWK(kid string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: AlgRS256,
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// PublicKey returns the RSA public key of an RSA JWK.
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// Thumbprint is the RFC 7638 JWK thumbprint of an RSA public key.
+func Thumbprint(pub *rsa.PublicKey) string {
+	jwk := PublicJWK("", pub)
+
+	// Members in lexicographic order, no whitespace, as RFC 7638 requires.
+	canonical := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	sum := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeySet holds the RSA keys used for ID tokens. The first key signs, the rest
+// are kept so tokens signed before a rotation can still be verified.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+func NewKeySet(keys ...Key) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+func (ks *KeySet) Active() (Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if len(ks.keys) == 0 {
+		return Key{}, ErrNoKey
+	}
+
+	return ks.keys[0], nil
+}
+
+// Rotate makes key the active key. The previous keys stay available for
+// verification until MaxKeys newer ones have been added.
+func (ks *KeySet) Rotate(key Key) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys = append([]Key{key}, ks.keys...)
+	if len(ks.keys) > MaxKeys {
+		ks.keys = ks.keys[:MaxKeys]
+	}
+}
+
+// Replace makes keys the keys of the set, the first one active. Only the
+// first MaxKeys are kept.
+func (ks *KeySet) Replace(keys []Key) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if len(keys) > MaxKeys {
+		keys = keys[:MaxKeys]
+	}
+
+	ks.keys = append([]Key(nil), keys...)
+}
+
+// Keys returns the keys, the active one first.
+func (ks *KeySet) Keys() []Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return append([]Key(nil), ks.keys...)
+}
+
+func (ks *KeySet) Lookup(kid string) (Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+
+	return Key{}, false
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwks.Keys = append(jwks.Keys, PublicJWK(k.ID, &k.Private.PublicKey))
+	}
+
+	return jwks
+}
@@ -1,9 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,51 +13,165 @@ import (
 
 type Manager struct {
 	signingKey string
+	tenantKeys map[string]string
+	keys       *KeySet
+	issuer     string
+	audience   string
 }
 
-type CustomClaims struct {
-	jwt.StandardClaims
-	GUID string `json:"guid"`
-}
+var ErrInvalidToken = errors.New("invalid token")
 
-func New(signingKey string) (*Manager, error) {
+// New creates a Manager that signs access tokens with signingKey and, when
+// idTokenKeys are given, ID tokens with the first of them.
+func New(signingKey string, idTokenKeys ...Key) (*Manager, error) {
 	const op = "auth.manager.NewManager"
 
 	if signingKey == "" {
 		return nil, fmt.Errorf("%s: %w", op, errors.New("empty signingKey"))
 	}
 
-	return &Manager{signingKey: signingKey}, nil
+	return &Manager{
+		signingKey: signingKey,
+		tenantKeys: make(map[string]string),
+		keys:       NewKeySet(idTokenKeys...),
+	}, nil
 }
 
-func (m *Manager) NewJWT(data string, ttl time.Duration) (string, error) {
+// SetTenantKey makes access tokens whose tid claim is tenantID use their own
+// signing key. It must be called before the Manager is used.
+func (m *Manager) SetTenantKey(tenantID string, signingKey string) error {
+	const op = "auth.manager.SetTenantKey"
+
+	if signingKey == "" {
+		return fmt.Errorf("%s: %w", op, errors.New("empty signingKey"))
+	}
+
+	m.tenantKeys[tenantID] = signingKey
+
+	return nil
+}
+
+// Expect makes ParseJWT accept only tokens issued by issuer for audience. An
+// empty issuer is not checked, an empty audience accepts only tokens without
+// one. It must be called before the Manager is used.
+func (m *Manager) Expect(issuer string, audience string) {
+	m.issuer = issuer
+	m.audience = audience
+}
+
+func (m *Manager) signingKeyFor(tenantID string) []byte {
+	if key, ok := m.tenantKeys[tenantID]; ok {
+		return []byte(key)
+	}
+
+	return []byte(m.signingKey)
+}
+
+func (m *Manager) NewJWT(data string, ttl time.Duration, opts ...ClaimsOption) (string, error) {
 	guid := uuid.New().String()
+	now := time.Now()
 
 	claims := CustomClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(ttl).Unix(),
+			Id:        guid,
+			ExpiresAt: now.Add(ttl).Unix(),
+			IssuedAt:  now.Unix(),
 			Subject:   data,
 		},
 		GUID: guid,
 	}
 
+	for _, opt := range opts {
+		opt(&claims)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
 
-	return token.SignedString([]byte(m.signingKey))
+	return token.SignedString(m.signingKeyFor(claims.TenantID))
+}
+
+// ParseJWT verifies an access token for this service.
+func (m *Manager) ParseJWT(accessToken string) (*CustomClaims, error) {
+	const op = "auth.manager.ParseJWT"
+
+	claims, err := m.parse(accessToken, VerifyOptions{Audience: m.audience, NoAudience: m.audience == ""})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, nil
+}
+
+// ParseIssuedJWT is ParseJWT for a token of any audience, such as one
+// exchanged for another service, for introspection on its behalf.
+func (m *Manager) ParseIssuedJWT(accessToken string) (*CustomClaims, error) {
+	const op = "auth.manager.ParseIssuedJWT"
+
+	claims, err := m.parse(accessToken, VerifyOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, nil
+}
+
+// parse verifies an access token as Verify does, with the key of its tenant
+// and the expected issuer added to opts.
+func (m *Manager) parse(accessToken string, opts VerifyOptions) (*CustomClaims, error) {
+	decoded, err := Decode(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// The claims are decoded before the signature is checked, so tid selects
+	// the key that the token must have been signed with.
+	tenantID, _ := decoded.Claims["tid"].(string)
+
+	opts.Secret = m.signingKeyFor(tenantID)
+	opts.Algorithm = jwt.SigningMethodHS512.Alg()
+	opts.Issuer = m.issuer
+
+	if err := decoded.verify(opts); err != nil {
+		return nil, err
+	}
+
+	var claims CustomClaims
+	if err := decoded.unmarshalClaims(&claims); err != nil {
+		return nil, verificationError(ReasonMalformed, "claims: %v", err)
+	}
+
+	return &claims, nil
 }
 
 func (m *Manager) NewRefreshToken() (string, error) {
 	const op = "auth.manager.NewRefreshToken"
 
-	b := make([]byte, 32)
+	token, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
 
-	s := rand.NewSource(time.Now().Unix())
-	r := rand.New(s)
+func (m *Manager) NewCode() (string, error) {
+	const op = "auth.manager.NewCode"
 
-	if _, err := r.Read(b); err != nil {
+	code, err := randomHex(32)
+	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	return code, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
 	return fmt.Sprintf("%x", b), nil
 }
 
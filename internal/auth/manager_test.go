@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"crypto/x509"
 	"testing"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,9 +28,9 @@ func TestNewJWT(t *testing.T) {
 	data := "data"
 	ttl := time.Duration(time.Duration.Hours(5))
 
-	jwt, err := m.NewJWT(data, ttl)
+	token, err := m.NewJWT(data, ttl)
 	require.NoError(t, err)
-	require.NotEmpty(t, jwt)
+	require.NotEmpty(t, token)
 }
 
 func TestHashToken(t *testing.T) {
@@ -58,3 +60,302 @@ func TestCompareTokensError(t *testing.T) {
 	ok := m.CompareTokens(providedToken, hashedToken)
 	require.False(t, ok)
 }
+
+func TestParseJWT(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	token, err := m.NewJWT("data", time.Hour, WithScope("read write"), WithClientID("spa"))
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "data", claims.Subject)
+	require.Equal(t, "read write", claims.Scope)
+	require.Equal(t, "spa", claims.ClientID)
+	require.Equal(t, claims.GUID, claims.Id)
+}
+
+func TestParseJWTAuthTime(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	authTime := time.Unix(1700000000, 0)
+
+	token, err := m.NewJWT("data", time.Hour, WithAuthTime(authTime))
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.True(t, authTime.Equal(claims.AuthenticatedAt()))
+
+	token, err = m.NewJWT("data", time.Hour)
+	require.NoError(t, err)
+
+	claims, err = m.ParseJWT(token)
+	require.NoError(t, err)
+	require.True(t, claims.AuthenticatedAt().IsZero())
+}
+
+func TestParseJWTError(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	other, err := New("other")
+	require.NoError(t, err)
+
+	token, err := other.NewJWT("data", time.Hour)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := m.NewJWT("data", -time.Hour)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(expired)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+// TestParseJWTReasons checks that ParseJWT explains failures the way Verify,
+// and so jwtctl, does.
+func TestParseJWTReasons(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+	m.Expect("https://auth.example.com", "")
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Issuer: "https://auth.example.com"}).SignedString([]byte("qwerty"))
+	require.NoError(t, err)
+
+	expired, err := m.NewJWT("data", -time.Hour, WithIssuer("https://auth.example.com"))
+	require.NoError(t, err)
+
+	wrongIssuer, err := m.NewJWT("data", time.Hour, WithIssuer("https://evil.example.com"))
+	require.NoError(t, err)
+
+	wrongAudience, err := m.NewJWT("data", time.Hour, WithIssuer("https://auth.example.com"), WithAudience("billing"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{name: "malformed", token: "not-a-token", reason: ReasonMalformed},
+		{name: "algorithm", token: hs256, reason: ReasonAlgorithm},
+		{name: "expired", token: expired, reason: ReasonExpired},
+		{name: "issuer", token: wrongIssuer, reason: ReasonIssuer},
+		{name: "audience", token: wrongAudience, reason: ReasonAudience},
+	}
+
+	for _, tt := range tests {
+		_, err := m.ParseJWT(tt.token)
+		require.ErrorIs(t, err, ErrInvalidToken, tt.name)
+
+		var verr *VerificationError
+		require.ErrorAs(t, err, &verr, tt.name)
+		require.Equal(t, tt.reason, verr.Reason, tt.name)
+	}
+}
+
+func TestNewIDToken(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	m, err := New("qwerty", key)
+	require.NoError(t, err)
+
+	idToken, err := m.NewIDToken(IDTokenClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "data", Audience: "spa", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		Nonce:          "nonce",
+	})
+	require.NoError(t, err)
+
+	var claims IDTokenClaims
+	token, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.Private.PublicKey, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, key.ID, token.Header["kid"])
+	require.Equal(t, "nonce", claims.Nonce)
+
+	jwks := m.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, key.ID, jwks.Keys[0].Kid)
+}
+
+func TestNewIDTokenError(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	_, err = m.NewIDToken(IDTokenClaims{})
+	require.ErrorIs(t, err, ErrNoKey)
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	// Example from OpenID Connect Core 1.0 appendix A.3.
+	require.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", AccessTokenHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"))
+}
+
+func TestParseJWTActor(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	actor := &Actor{Subject: "gateway", Act: &Actor{Subject: "support"}}
+
+	token, err := m.NewJWT("data", time.Hour, WithAudience("billing"), WithActor(actor))
+	require.NoError(t, err)
+
+	claims, err := m.ParseIssuedJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "billing", claims.Audience)
+	require.Equal(t, actor, claims.Act)
+}
+
+func TestParseJWTCustomClaims(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+	m.Expect("https://auth.example.com", "")
+
+	token, err := m.NewJWT("data", time.Hour,
+		WithIssuer("https://auth.example.com"),
+		WithRoles("admin", "support"),
+		WithClaim("tenant", "acme"),
+		WithClaim("sub", "spoofed"),
+	)
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "data", claims.Subject)
+	require.Equal(t, "https://auth.example.com", claims.Issuer)
+	require.Equal(t, []string{"admin", "support"}, claims.Roles)
+	require.Equal(t, map[string]interface{}{"tenant": "acme"}, claims.Extra)
+}
+
+func TestParseJWTIssuerAndAudience(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+	m.Expect("https://auth.example.com", "auth")
+
+	token, err := m.NewJWT("data", time.Hour, WithIssuer("https://auth.example.com"), WithAudience("auth"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(token)
+	require.NoError(t, err)
+
+	wrongIssuer, err := m.NewJWT("data", time.Hour, WithIssuer("https://evil.example.com"), WithAudience("auth"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(wrongIssuer)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = m.ParseIssuedJWT(wrongIssuer)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongAudience, err := m.NewJWT("data", time.Hour, WithIssuer("https://auth.example.com"), WithAudience("billing"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(wrongAudience)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// Introspection answers for the service the token is for.
+	claims, err := m.ParseIssuedJWT(wrongAudience)
+	require.NoError(t, err)
+	require.Equal(t, "billing", claims.Audience)
+}
+
+func TestParseJWTConfirmation(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	cnf := Confirmation{X5tS256: CertificateThumbprint(cert)}
+
+	token, err := m.NewJWT("data", time.Hour, WithConfirmation(cnf), WithClaim("cnf", "spoofed"))
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, &cnf, claims.Cnf)
+	require.Nil(t, claims.Extra)
+	require.Equal(t, "A9Zt0Ig1wco_EozOrNHzGslBYwlrIPRFroQoW8CDLXI", cnf.X5tS256)
+
+	token, err = m.NewJWT("data", time.Hour, WithConfirmation(Confirmation{}))
+	require.NoError(t, err)
+
+	claims, err = m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Nil(t, claims.Cnf)
+}
+
+func TestParseJWTTenantKey(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+	require.NoError(t, m.SetTenantKey("acme", "acme-key"))
+
+	token, err := m.NewJWT("data", time.Hour, WithTenant("acme"))
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "acme", claims.TenantID)
+
+	// Tokens of other tenants are signed with the default key and must not
+	// verify under the acme key.
+	other, err := New("qwerty")
+	require.NoError(t, err)
+
+	token, err = other.NewJWT("data", time.Hour, WithTenant("acme"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRotateKey(t *testing.T) {
+	first, err := GenerateKey()
+	require.NoError(t, err)
+
+	m, err := New("qwerty", first)
+	require.NoError(t, err)
+
+	for i := 0; i < MaxKeys; i++ {
+		key, err := GenerateKey()
+		require.NoError(t, err)
+
+		m.RotateKey(key)
+
+		active, err := m.keys.Active()
+		require.NoError(t, err)
+		require.Equal(t, key.ID, active.ID)
+	}
+
+	jwks := m.JWKS()
+	require.Len(t, jwks.Keys, MaxKeys)
+
+	_, ok := m.keys.Lookup(first.ID)
+	require.False(t, ok)
+}
+
+func TestEncryptPrivateKey(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	sealed, err := EncryptPrivateKey(key.Private, "secret", key.ID)
+	require.NoError(t, err)
+	require.NotContains(t, string(sealed), string(x509.MarshalPKCS1PrivateKey(key.Private)))
+
+	private, err := DecryptPrivateKey(sealed, "secret", key.ID)
+	require.NoError(t, err)
+	require.True(t, key.Private.Equal(private))
+
+	_, err = DecryptPrivateKey(sealed, "other", key.ID)
+	require.Error(t, err)
+
+	_, err = DecryptPrivateKey(sealed, "secret", "other-kid")
+	require.Error(t, err)
+
+	_, err = EncryptPrivateKey(key.Private, "", key.ID)
+	require.Error(t, err)
+}
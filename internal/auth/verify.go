@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Reasons reported by a VerificationError.
+const (
+	ReasonMalformed   = "malformed"
+	ReasonAlgorithm   = "algorithm"
+	ReasonUnknownKey  = "unknown_key"
+	ReasonSignature   = "signature"
+	ReasonExpired     = "expired"
+	ReasonNotYetValid = "not_yet_valid"
+	ReasonAudience    = "audience"
+	ReasonIssuer      = "issuer"
+)
+
+// VerificationError explains why Verify rejected a token. It wraps
+// ErrInvalidToken.
+type VerificationError struct {
+	Reason string
+	Detail string
+}
+
+func (e *VerificationError) Error() string {
+	return e.Reason + ": " + e.Detail
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrInvalidToken
+}
+
+func verificationError(reason string, format string, args ...interface{}) error {
+	return &VerificationError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// DecodedToken is the header and payload of a JWT.
+type DecodedToken struct {
+	Header map[string]interface{} `json:"header"`
+	Claims map[string]interface{} `json:"claims"`
+
+	signingString string
+	signature     string
+	payload       []byte
+}
+
+// Decode splits a JWT into its header and claims without verifying it.
+func Decode(token string) (*DecodedToken, error) {
+	const op = "auth.verify.Decode"
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s: %w", op, verificationError(ReasonMalformed, "token has %d parts, want 3", len(parts)))
+	}
+
+	decoded := &DecodedToken{
+		signingString: parts[0] + "." + parts[1],
+		signature:     parts[2],
+	}
+
+	if _, err := decodeSegment(parts[0], &decoded.Header); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, verificationError(ReasonMalformed, "header: %v", err))
+	}
+
+	payload, err := decodeSegment(parts[1], &decoded.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, verificationError(ReasonMalformed, "claims: %v", err))
+	}
+	decoded.payload = payload
+
+	return decoded, nil
+}
+
+func decodeSegment(segment string, v interface{}) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return data, json.Unmarshal(data, v)
+}
+
+// VerifyOptions are the keys and expectations Verify checks a token against.
+type VerifyOptions struct {
+	// Secret verifies HMAC signed tokens, such as access tokens.
+	Secret []byte
+	// JWKS verifies RSA signed tokens, such as ID tokens. A key without a
+	// kid matches any token.
+	JWKS *JWKS
+	// Algorithm, when set, is the only algorithm accepted.
+	Algorithm string
+	// Audience and Issuer are checked when set. NoAudience requires a token
+	// without an audience instead.
+	Audience   string
+	NoAudience bool
+	Issuer     string
+	// Now is the time to check exp and nbf against, time.Now if zero.
+	Now time.Time
+}
+
+// Verify decodes a token and checks its algorithm, key, signature, lifetime,
+// audience and issuer, in that order. The returned error explains the first
+// check that failed as a *VerificationError. Manager.ParseJWT verifies access
+// tokens the same way.
+func Verify(token string, opts VerifyOptions) (*DecodedToken, error) {
+	const op = "auth.verify.Verify"
+
+	decoded, err := Decode(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decoded.verify(opts); err != nil {
+		return decoded, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return decoded, nil
+}
+
+func (d *DecodedToken) verify(opts VerifyOptions) error {
+	if err := d.verifySignature(opts); err != nil {
+		return err
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	return d.verifyClaims(opts, now)
+}
+
+func (d *DecodedToken) verifySignature(opts VerifyOptions) error {
+	alg, _ := d.Header["alg"].(string)
+	kid, _ := d.Header["kid"].(string)
+
+	method := jwt.GetSigningMethod(alg)
+	if method == nil || alg == "none" {
+		return verificationError(ReasonAlgorithm, "unsupported algorithm %q", alg)
+	}
+
+	if opts.Algorithm != "" && alg != opts.Algorithm {
+		return verificationError(ReasonAlgorithm, "token is signed with %s, want %s", alg, opts.Algorithm)
+	}
+
+	var key interface{}
+
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(opts.Secret) == 0 {
+			return verificationError(ReasonAlgorithm, "token is signed with %s, but no HMAC secret was given", alg)
+		}
+
+		key = opts.Secret
+	case *jwt.SigningMethodRSA:
+		if opts.JWKS == nil {
+			return verificationError(ReasonAlgorithm, "token is signed with %s, but no RSA key was given", alg)
+		}
+
+		jwk, err := opts.JWKS.lookup(kid)
+		if err != nil {
+			return err
+		}
+
+		if jwk.Alg != "" && jwk.Alg != alg {
+			return verificationError(ReasonAlgorithm, "token is signed with %s, but key %q is for %s", alg, jwk.Kid, jwk.Alg)
+		}
+
+		public, err := jwk.PublicKey()
+		if err != nil {
+			return verificationError(ReasonUnknownKey, "key %q: %v", jwk.Kid, err)
+		}
+
+		key = public
+	default:
+		return verificationError(ReasonAlgorithm, "unsupported algorithm %q", alg)
+	}
+
+	if err := method.Verify(d.signingString, d.signature, key); err != nil {
+		return verificationError(ReasonSignature, "signature does not match the key: %v", err)
+	}
+
+	return nil
+}
+
+func (ks JWKS) lookup(kid string) (JWK, error) {
+	var known []string
+
+	for _, k := range ks.Keys {
+		if k.Kid == "" || k.Kid == kid {
+			return k, nil
+		}
+
+		known = append(known, k.Kid)
+	}
+
+	if kid == "" {
+		return JWK{}, verificationError(ReasonUnknownKey, "token has no kid and no key matches any kid, known: %s", strings.Join(known, ", "))
+	}
+
+	return JWK{}, verificationError(ReasonUnknownKey, "no key with kid %q, known: %s", kid, strings.Join(known, ", "))
+}
+
+func (d *DecodedToken) verifyClaims(opts VerifyOptions, now time.Time) error {
+	if exp, ok := d.time("exp"); ok && !now.Before(exp) {
+		return verificationError(ReasonExpired, "token expired %s ago, at %s", now.Sub(exp).Round(time.Second), exp.Format(time.RFC3339))
+	}
+
+	if nbf, ok := d.time("nbf"); ok && now.Before(nbf) {
+		return verificationError(ReasonNotYetValid, "token is valid in %s, at %s", nbf.Sub(now).Round(time.Second), nbf.Format(time.RFC3339))
+	}
+
+	if opts.Audience != "" {
+		audience := d.audience()
+		if !containsString(audience, opts.Audience) {
+			return verificationError(ReasonAudience, "token is for %q, want %q", strings.Join(audience, ", "), opts.Audience)
+		}
+	}
+
+	if opts.NoAudience {
+		if audience := d.audience(); len(audience) > 0 {
+			return verificationError(ReasonAudience, "token is for %q, want none", strings.Join(audience, ", "))
+		}
+	}
+
+	if opts.Issuer != "" {
+		if iss, _ := d.Claims["iss"].(string); iss != opts.Issuer {
+			return verificationError(ReasonIssuer, "token is issued by %q, want %q", iss, opts.Issuer)
+		}
+	}
+
+	return nil
+}
+
+// unmarshalClaims decodes the payload into v, such as *CustomClaims.
+func (d *DecodedToken) unmarshalClaims(v interface{}) error {
+	return json.Unmarshal(d.payload, v)
+}
+
+// time reads a NumericDate claim.
+func (d *DecodedToken) time(name string) (time.Time, bool) {
+	v, ok := d.Claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	sec, frac := math.Modf(v)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// audience reads the aud claim, which may be a string or a list of them.
+func (d *DecodedToken) audience() []string {
+	switch aud := d.Claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		audience := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	m, err := New("qwerty")
+	require.NoError(t, err)
+
+	token, err := m.NewJWT("user", time.Hour, WithAudience("api"), WithIssuer("medods"))
+	require.NoError(t, err)
+
+	decoded, err := Verify(token, VerifyOptions{Secret: []byte("qwerty"), Audience: "api", Issuer: "medods"})
+	require.NoError(t, err)
+	require.Equal(t, "user", decoded.Claims["sub"])
+	require.Equal(t, "HS512", decoded.Header["alg"])
+
+	tests := []struct {
+		name   string
+		opts   VerifyOptions
+		reason string
+	}{
+		{name: "wrong secret", opts: VerifyOptions{Secret: []byte("other")}, reason: ReasonSignature},
+		{name: "rsa key only", opts: VerifyOptions{JWKS: &JWKS{}}, reason: ReasonAlgorithm},
+		{name: "expired", opts: VerifyOptions{Secret: []byte("qwerty"), Now: time.Now().Add(2 * time.Hour)}, reason: ReasonExpired},
+		{name: "audience", opts: VerifyOptions{Secret: []byte("qwerty"), Audience: "admin"}, reason: ReasonAudience},
+		{name: "issuer", opts: VerifyOptions{Secret: []byte("qwerty"), Issuer: "other"}, reason: ReasonIssuer},
+	}
+
+	for _, tt := range tests {
+		_, err := Verify(token, tt.opts)
+		require.ErrorIs(t, err, ErrInvalidToken, tt.name)
+
+		var verr *VerificationError
+		require.True(t, errors.As(err, &verr), tt.name)
+		require.Equal(t, tt.reason, verr.Reason, tt.name)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	m, err := New("qwerty", key)
+	require.NoError(t, err)
+
+	token, err := m.NewIDToken(IDTokenClaims{StandardClaims: jwt.StandardClaims{Subject: "user"}})
+	require.NoError(t, err)
+
+	jwks := m.JWKS()
+	_, err = Verify(token, VerifyOptions{JWKS: &jwks})
+	require.NoError(t, err)
+
+	other, err := GenerateKey()
+	require.NoError(t, err)
+
+	_, err = Verify(token, VerifyOptions{JWKS: &JWKS{Keys: []JWK{PublicJWK(other.ID, &other.Private.PublicKey)}}})
+	var verr *VerificationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, ReasonUnknownKey, verr.Reason)
+
+	_, err = Verify(token, VerifyOptions{JWKS: &JWKS{Keys: []JWK{PublicJWK("", &other.Private.PublicKey)}}})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, ReasonSignature, verr.Reason)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	_, err := Decode("not-a-token")
+
+	var verr *VerificationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, ReasonMalformed, verr.Reason)
+}
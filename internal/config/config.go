@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -12,13 +16,46 @@ type Config struct {
 	Env        string `yaml:"env" env-default:"local"`
 	HTTPServer `yaml:"http_server"`
 	Mongo
-	JWT `yaml:"jwt"`
+	JWT       `yaml:"jwt"`
+	RateLimit `yaml:"rate_limit"`
+	OAuth     `yaml:"oauth"`
+	RBAC      `yaml:"rbac"`
+	Policy    `yaml:"policy"`
+	Tenancy   `yaml:"tenancy"`
+	Metrics   `yaml:"metrics"`
+	Tracing   `yaml:"tracing"`
+	Audit     `yaml:"audit"`
+	Webhooks  `yaml:"webhooks"`
+	DPoP      `yaml:"dpop"`
 }
 
+// HTTPServer keeps serving for DrainDelay after it is told to stop, while
+// /readyz already fails.
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	DrainDelay  time.Duration `yaml:"drain_delay" env-default:"0s"`
+	TLS         TLS           `yaml:"tls"`
+}
+
+// TLS serves HTTPS with the certificate in CertFile, which is reloaded when
+// it changes on disk. Without CipherSuites Go's defaults are used. Setting
+// ClientCAFile enables mutual TLS: ClientAuth "optional" verifies client
+// certificates when they are sent, "require" refuses connections without one.
+// Only the certificates in AdminCertificates, by subject common name or
+// x5t#S256 thumbprint, may use the admin API without a token.
+type TLS struct {
+	Enabled        bool          `yaml:"enabled" env-default:"false"`
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	MinVersion     string        `yaml:"min_version" env-default:"1.2"`
+	CipherSuites   []string      `yaml:"cipher_suites"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"1m"`
+	ClientCAFile   string        `yaml:"client_ca_file"`
+	ClientAuth     string        `yaml:"client_auth" env-default:"optional"`
+
+	AdminCertificates []string `yaml:"admin_certificates"`
 }
 
 type Mongo struct {
@@ -29,10 +66,202 @@ type Mongo struct {
 	Database string
 }
 
+// JWT signs access tokens with SigningKey, from JWT_SIGNING_KEY, and ID
+// tokens with the key in PrivateKeyFile or a rotated one. Rotated keys are
+// stored encrypted with KeyEncryptionKey, from KEY_ENCRYPTION_KEY, and
+// reloaded from the storage every KeyReloadInterval, or never if it is 0.
 type JWT struct {
+	AccessTokenTTL    time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL   time.Duration `yaml:"refresh_token_ttl"`
+	IDTokenTTL        time.Duration `yaml:"id_token_ttl" env-default:"1h"`
+	Issuer            string        `yaml:"issuer" env:"JWT_ISSUER"`
+	Audience          string        `yaml:"audience"`
+	PrivateKeyFile    string        `yaml:"private_key_file"`
+	KeyReloadInterval time.Duration `yaml:"key_reload_interval" env-default:"1m"`
+	SigningKey        string
+	KeyEncryptionKey  string `yaml:"-"`
+}
+
+type RateLimit struct {
+	Enabled bool                     `yaml:"enabled" env-default:"false"`
+	Store   string                   `yaml:"store" env-default:"memory"`
+	Default RateLimitRule            `yaml:"default"`
+	Routes  map[string]RateLimitRule `yaml:"routes"`
+}
+
+type RateLimitRule struct {
+	Algorithm string        `yaml:"algorithm" env-default:"token_bucket"`
+	KeyBy     string        `yaml:"key_by" env-default:"ip"`
+	Limit     int           `yaml:"limit"`
+	Window    time.Duration `yaml:"window"`
+	Burst     int           `yaml:"burst"`
+}
+
+type OAuth struct {
+	CodeTTL            time.Duration `yaml:"code_ttl" env-default:"1m"`
+	DeviceCodeTTL      time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	Clients            []OAuthClient `yaml:"clients"`
+}
+
+type OAuthClient struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	SecretHash   string   `yaml:"secret_hash"`
+	RedirectURIs []string `yaml:"redirect_uris"`
+	Scopes       []string `yaml:"scopes"`
+	GrantTypes   []string `yaml:"grant_types"`
+	// TLSSubject lets the client authenticate with a TLS client certificate
+	// whose subject common name it is, instead of a secret.
+	TLSSubject string `yaml:"tls_subject"`
+
+	TokenExchange OAuthTokenExchange `yaml:"token_exchange"`
+}
+
+type OAuthTokenExchange struct {
+	Audiences     []string `yaml:"audiences"`
+	Delegation    bool     `yaml:"delegation"`
+	Impersonation bool     `yaml:"impersonation"`
+}
+
+type RBAC struct {
+	Roles []RBACRole `yaml:"roles"`
+	// Assignments maps clients, named "client:<id>", to the roles granted at
+	// startup. Users get no roles in their tokens, since /auth issues them
+	// for any name.
+	Assignments map[string][]string `yaml:"assignments"`
+}
+
+type RBACRole struct {
+	Name        string   `yaml:"name"`
+	Permissions []string `yaml:"permissions"`
+}
+
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+type PolicyRule struct {
+	Name      string   `yaml:"name"`
+	Effect    string   `yaml:"effect" env-default:"allow"`
+	Actions   []string `yaml:"actions"`
+	Condition string   `yaml:"condition"`
+}
+
+// Tenancy is disabled while no tenants are declared.
+type Tenancy struct {
+	Header  string   `yaml:"header" env-default:"X-Tenant-ID"`
+	Default string   `yaml:"default"`
+	Tenants []Tenant `yaml:"tenants"`
+}
+
+// Tenant TTLs of zero fall back to the JWT section. Without a key in
+// SigningKeyEnv the tenant's tokens are signed with the default key.
+type Tenant struct {
+	ID              string        `yaml:"id"`
+	Hosts           []string      `yaml:"hosts"`
 	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
 	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
-	SigningKey      string
+	SigningKeyEnv   string        `yaml:"signing_key_env"`
+	SigningKey      string        `yaml:"-"`
+}
+
+type Metrics struct {
+	Enabled bool   `yaml:"enabled" env-default:"false"`
+	Path    string `yaml:"path" env-default:"/metrics"`
+}
+
+// Tracing exports spans to an OTLP/HTTP collector at Endpoint, or prints
+// them to stdout for local testing.
+type Tracing struct {
+	Enabled     bool    `yaml:"enabled" env-default:"false"`
+	Exporter    string  `yaml:"exporter" env-default:"stdout"`
+	Endpoint    string  `yaml:"endpoint" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env-default:"false"`
+	ServiceName string  `yaml:"service_name" env-default:"auth"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+// Audit sinks are "mongo", "file" (JSON lines appended to File) and "slog".
+// Only the mongo sink can be queried through the admin API.
+type Audit struct {
+	Enabled bool     `yaml:"enabled" env-default:"false"`
+	Sinks   []string `yaml:"sinks"`
+	File    string   `yaml:"file" env-default:"audit.log"`
+}
+
+// Webhooks posts service events to the endpoints subscribed to them. A
+// failed delivery is retried MaxAttempts times in all, waiting Backoff after
+// the first attempt and twice as long after each next one, up to MaxBackoff.
+// An instance holds a lease on the deliveries it works on, which runs Lease
+// past their next attempt. Other instances take over deliveries whose lease
+// has run out, and look for them every Lease.
+type Webhooks struct {
+	Enabled     bool              `yaml:"enabled" env-default:"false"`
+	Timeout     time.Duration     `yaml:"timeout" env-default:"5s"`
+	MaxAttempts int               `yaml:"max_attempts" env-default:"5"`
+	Backoff     time.Duration     `yaml:"backoff" env-default:"1s"`
+	MaxBackoff  time.Duration     `yaml:"max_backoff" env-default:"5m"`
+	Lease       time.Duration     `yaml:"lease" env-default:"1m"`
+	Endpoints   []WebhookEndpoint `yaml:"endpoints"`
+}
+
+// WebhookEndpoint receives the listed event types, or all of them when
+// Events is empty. Payloads are signed with the secret in SecretEnv.
+type WebhookEndpoint struct {
+	URL       string   `yaml:"url"`
+	Events    []string `yaml:"events"`
+	SecretEnv string   `yaml:"secret_env"`
+	Secret    string   `yaml:"-"`
+}
+
+// DPoP binds tokens to the key of the proofs sent with them (RFC 9449).
+// Proofs are accepted within ProofLifetime of their iat, and their jti is
+// remembered that long in Store, "memory" or "mongo".
+type DPoP struct {
+	Enabled       bool          `yaml:"enabled" env-default:"false"`
+	ProofLifetime time.Duration `yaml:"proof_lifetime" env-default:"1m"`
+	Store         string        `yaml:"store" env-default:"memory"`
+}
+
+const redacted = "REDACTED"
+
+// Redacted returns a copy of cfg that is safe to show: secrets are replaced
+// and credentials are removed from the Mongo URI.
+func (cfg Config) Redacted() Config {
+	cfg.JWT.SigningKey = redact(cfg.JWT.SigningKey)
+	cfg.JWT.KeyEncryptionKey = redact(cfg.JWT.KeyEncryptionKey)
+	cfg.Mongo.Password = redact(cfg.Mongo.Password)
+
+	if u, err := url.Parse(cfg.Mongo.URI); err == nil && u.User != nil {
+		u.User = url.User(redacted)
+		cfg.Mongo.URI = u.String()
+	}
+
+	cfg.OAuth.Clients = append([]OAuthClient(nil), cfg.OAuth.Clients...)
+	for i := range cfg.OAuth.Clients {
+		cfg.OAuth.Clients[i].SecretHash = redact(cfg.OAuth.Clients[i].SecretHash)
+	}
+
+	cfg.Tenancy.Tenants = append([]Tenant(nil), cfg.Tenancy.Tenants...)
+	for i := range cfg.Tenancy.Tenants {
+		cfg.Tenancy.Tenants[i].SigningKey = redact(cfg.Tenancy.Tenants[i].SigningKey)
+	}
+
+	cfg.Webhooks.Endpoints = append([]WebhookEndpoint(nil), cfg.Webhooks.Endpoints...)
+	for i := range cfg.Webhooks.Endpoints {
+		cfg.Webhooks.Endpoints[i].Secret = redact(cfg.Webhooks.Endpoints[i].Secret)
+	}
+
+	return cfg
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return redacted
 }
 
 func MustLoad() *Config {
@@ -53,9 +282,49 @@ func MustLoad() *Config {
 
 	setFromEnv(&cfg)
 
+	if err := validate(&cfg); err != nil {
+		log.Fatalf("invalid config: %s", err)
+	}
+
 	return &cfg
 }
 
+// validate rejects settings the service must not start with. Only local
+// environments may leave the issuer unset.
+func validate(cfg *Config) error {
+	if cfg.JWT.Issuer == "" && cfg.Env != "local" {
+		return errors.New("jwt.issuer or JWT_ISSUER is required")
+	}
+
+	// A tenant that asks for its own key must not silently share the default.
+	for _, t := range cfg.Tenancy.Tenants {
+		if t.SigningKeyEnv != "" && t.SigningKey == "" {
+			return fmt.Errorf("tenant %s: %s is not set", t.ID, t.SigningKeyEnv)
+		}
+	}
+
+	if cfg.Webhooks.Enabled && cfg.Webhooks.Lease <= 0 {
+		return errors.New("webhooks.lease must be positive")
+	}
+
+	// An endpoint without a secret would get payloads signed with an empty key.
+	if cfg.Webhooks.Enabled {
+		for _, e := range cfg.Webhooks.Endpoints {
+			if e.Secret == "" {
+				return fmt.Errorf("webhook %s: secret_env %q is not set", e.URL, e.SecretEnv)
+			}
+		}
+	}
+
+	for name := range cfg.RBAC.Assignments {
+		if !strings.HasPrefix(name, "client:") {
+			return fmt.Errorf("rbac.assignments: %q is not a client, roles are only assigned to \"client:<id>\"", name)
+		}
+	}
+
+	return nil
+}
+
 func setFromEnv(cfg *Config) {
 	if cfg.Env == "local" {
 		cfg.Mongo.URI = "mongodb://localhost:27017"
@@ -67,4 +336,17 @@ func setFromEnv(cfg *Config) {
 	cfg.Mongo.Database = os.Getenv("MONGO_DATABASE")
 
 	cfg.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
+	cfg.JWT.KeyEncryptionKey = os.Getenv("KEY_ENCRYPTION_KEY")
+
+	for i, t := range cfg.Tenancy.Tenants {
+		if t.SigningKeyEnv != "" {
+			cfg.Tenancy.Tenants[i].SigningKey = os.Getenv(t.SigningKeyEnv)
+		}
+	}
+
+	for i, e := range cfg.Webhooks.Endpoints {
+		if e.SecretEnv != "" {
+			cfg.Webhooks.Endpoints[i].Secret = os.Getenv(e.SecretEnv)
+		}
+	}
 }
@@ -0,0 +1,45 @@
+package dpop
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// purgeInterval is how often MemoryCache drops expired keys.
+const purgeInterval = time.Minute
+
+// MemoryCache is a ReplayCache for a single instance.
+type MemoryCache struct {
+	mu     sync.Mutex
+	keys   map[string]time.Time
+	purged time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{keys: make(map[string]time.Time), purged: time.Now()}
+}
+
+func (c *MemoryCache) Remember(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(c.purged) >= purgeInterval {
+		for k, exp := range c.keys {
+			if now.After(exp) {
+				delete(c.keys, k)
+			}
+		}
+		c.purged = now
+	}
+
+	if exp, ok := c.keys[key]; ok && !now.After(exp) {
+		return false, nil
+	}
+
+	c.keys[key] = expiresAt
+
+	return true, nil
+}
@@ -0,0 +1,168 @@
+// Package dpop verifies DPoP proofs (RFC 9449), with which a client shows that
+// it holds the private key its tokens are bound to.
+package dpop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// Header carries the proof of a request.
+	Header = "DPoP"
+	// Scheme is the Authorization scheme of DPoP-bound access tokens.
+	Scheme = "DPoP"
+
+	proofType = "dpop+jwt"
+)
+
+// SigningAlgs are the proof signature algorithms accepted.
+var SigningAlgs = []string{"RS256", "ES256"}
+
+var ErrInvalidProof = errors.New("invalid DPoP proof")
+
+// Proof is a verified proof.
+type Proof struct {
+	// JKT is the JWK SHA-256 thumbprint of the key that signed the proof.
+	JKT      string
+	JTI      string
+	IssuedAt time.Time
+	// ATH is the hash of the access token sent with the proof, if any.
+	ATH string
+}
+
+// ReplayCache remembers proofs until they expire. Remember returns false for
+// a key it has already seen.
+type ReplayCache interface {
+	Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+}
+
+type Verifier struct {
+	cache    ReplayCache
+	lifetime time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier accepts proofs issued less than lifetime away from now, in
+// either direction to allow for clock skew.
+func NewVerifier(cache ReplayCache, lifetime time.Duration) *Verifier {
+	return &Verifier{cache: cache, lifetime: lifetime, now: time.Now}
+}
+
+type claims struct {
+	JTI string `json:"jti"`
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	IAT int64  `json:"iat"`
+	ATH string `json:"ath,omitempty"`
+}
+
+// Valid is checked by Verify, which knows the request.
+func (c *claims) Valid() error {
+	return nil
+}
+
+// Verify checks proof for a request with the given method and URL. The query
+// and fragment of the URLs are ignored.
+func (v *Verifier) Verify(ctx context.Context, proof string, method string, requestURL string) (Proof, error) {
+	const op = "dpop.Verify"
+
+	var key jwk
+	parser := jwt.Parser{ValidMethods: SigningAlgs}
+
+	var c claims
+	_, err := parser.ParseWithClaims(proof, &c, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("typ is not %s", proofType)
+		}
+
+		raw, err := json.Marshal(t.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, fmt.Errorf("malformed jwk: %w", err)
+		}
+
+		return key.publicKey()
+	})
+	if err != nil {
+		return Proof{}, fmt.Errorf("%s: %w: %v", op, ErrInvalidProof, err)
+	}
+
+	if c.JTI == "" {
+		return Proof{}, fmt.Errorf("%s: %w: jti is missing", op, ErrInvalidProof)
+	}
+
+	if c.HTM != method {
+		return Proof{}, fmt.Errorf("%s: %w: htm does not match", op, ErrInvalidProof)
+	}
+
+	if !sameURL(c.HTU, requestURL) {
+		return Proof{}, fmt.Errorf("%s: %w: htu does not match", op, ErrInvalidProof)
+	}
+
+	issuedAt := time.Unix(c.IAT, 0)
+	if age := v.now().Sub(issuedAt); age > v.lifetime || age < -v.lifetime {
+		return Proof{}, fmt.Errorf("%s: %w: iat is out of range", op, ErrInvalidProof)
+	}
+
+	jkt, err := key.thumbprint()
+	if err != nil {
+		return Proof{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Both ends of the iat window have to pass before the proof can be
+	// forgotten.
+	fresh, err := v.cache.Remember(ctx, jkt+":"+c.JTI, issuedAt.Add(v.lifetime))
+	if err != nil {
+		return Proof{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !fresh {
+		return Proof{}, fmt.Errorf("%s: %w: jti was already used", op, ErrInvalidProof)
+	}
+
+	return Proof{JKT: jkt, JTI: c.JTI, IssuedAt: issuedAt, ATH: c.ATH}, nil
+}
+
+// AccessTokenHash is the ath claim a proof carries when it is sent with
+// accessToken.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func sameURL(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) && ua.Path == ub.Path
+}
+
+type proofKey struct{}
+
+func NewContext(ctx context.Context, proof Proof) context.Context {
+	return context.WithValue(ctx, proofKey{}, proof)
+}
+
+// FromContext returns the verified proof of the request in ctx.
+func FromContext(ctx context.Context) (Proof, bool) {
+	proof, ok := ctx.Value(proofKey{}).(Proof)
+	return proof, ok
+}
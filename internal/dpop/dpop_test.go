@@ -0,0 +1,92 @@
+package dpop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+const tokenURL = "https://auth.example.com/auth"
+
+func newProof(t *testing.T, key *ecdsa.PrivateKey, c claims, header map[string]interface{}) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &c)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	for k, v := range header {
+		token.Header[k] = v
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	v := NewVerifier(NewMemoryCache(), time.Minute)
+
+	valid := claims{JTI: "1", HTM: "GET", HTU: tokenURL, IAT: now.Unix()}
+
+	proof, err := v.Verify(context.Background(), newProof(t, key, valid, nil), "GET", tokenURL+"?x=1")
+	require.NoError(t, err)
+	require.NotEmpty(t, proof.JKT)
+	require.Equal(t, "1", proof.JTI)
+
+	other := valid
+	other.JTI = "2"
+	again, err := v.Verify(context.Background(), newProof(t, key, other, nil), "GET", tokenURL)
+	require.NoError(t, err)
+	require.Equal(t, proof.JKT, again.JKT)
+
+	tests := []struct {
+		name   string
+		claims claims
+		header map[string]interface{}
+	}{
+		{name: "replayed", claims: valid},
+		{name: "method", claims: claims{JTI: "3", HTM: "POST", HTU: tokenURL, IAT: now.Unix()}},
+		{name: "url", claims: claims{JTI: "4", HTM: "GET", HTU: "https://auth.example.com/refresh", IAT: now.Unix()}},
+		{name: "stale", claims: claims{JTI: "5", HTM: "GET", HTU: tokenURL, IAT: now.Add(-2 * time.Minute).Unix()}},
+		{name: "no jti", claims: claims{HTM: "GET", HTU: tokenURL, IAT: now.Unix()}},
+		{name: "typ", claims: claims{JTI: "6", HTM: "GET", HTU: tokenURL, IAT: now.Unix()}, header: map[string]interface{}{"typ": "JWT"}},
+		{name: "private key", claims: claims{JTI: "7", HTM: "GET", HTU: tokenURL, IAT: now.Unix()}, header: map[string]interface{}{
+			"jwk": map[string]string{"kty": "EC", "crv": "P-256", "x": "AA", "y": "AA", "d": "AA"},
+		}},
+	}
+
+	for _, tt := range tests {
+		_, err := v.Verify(context.Background(), newProof(t, key, tt.claims, tt.header), "GET", tokenURL)
+		require.ErrorIs(t, err, ErrInvalidProof, tt.name)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example of RFC 7638 section 3.1.
+	k := jwk{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+
+	jkt, err := k.thumbprint()
+	require.NoError(t, err)
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jkt)
+}
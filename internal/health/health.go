@@ -0,0 +1,136 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds a readiness probe, so a hanging dependency fails the
+// probe instead of blocking it.
+const checkTimeout = 2 * time.Second
+
+// Statuses of the service and of each dependency.
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks. It is ready while every check passes
+// and Drain has not been called.
+type Checker struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{}
+}
+
+// Add registers a readiness check under name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the service report that it is not ready, whatever its checks
+// say, so that load balancers stop sending it traffic before it shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+type DependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// Run runs all checks concurrently.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	statuses := make([]DependencyStatus, len(checks))
+
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			statuses[i] = DependencyStatus{Status: StatusOK}
+			if err := check(ctx); err != nil {
+				statuses[i] = DependencyStatus{Status: StatusFailing, Error: err.Error()}
+			}
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]DependencyStatus, len(checks))}
+	for i, nc := range checks {
+		report.Checks[nc.name] = statuses[i]
+		if statuses[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	if c.draining.Load() {
+		report.Status = StatusDraining
+	}
+
+	return report
+}
+
+// Live answers 200 for as long as the process can serve requests at all.
+func (c *Checker) Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render(w, http.StatusOK, Report{Status: StatusOK, Checks: map[string]DependencyStatus{}})
+	})
+}
+
+// Ready answers 200 with the status of every dependency when the service is
+// ready, and 503 otherwise.
+func (c *Checker) Ready() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		render(w, status, report)
+	})
+}
+
+func render(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(report)
+}
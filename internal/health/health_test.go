@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func ready(t *testing.T, c *Checker) (int, Report) {
+	rec := httptest.NewRecorder()
+	c.Ready().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+
+	return rec.Code, report
+}
+
+func TestReady(t *testing.T) {
+	mongoErr := error(nil)
+
+	c := New()
+	c.Add("mongo", func(ctx context.Context) error { return mongoErr })
+	c.Add("signing_keys", func(ctx context.Context) error { return nil })
+
+	code, report := ready(t, c)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, StatusOK, report.Checks["mongo"].Status)
+
+	mongoErr = errors.New("connection refused")
+
+	code, report = ready(t, c)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, StatusFailing, report.Status)
+	require.Equal(t, DependencyStatus{Status: StatusFailing, Error: "connection refused"}, report.Checks["mongo"])
+	require.Equal(t, StatusOK, report.Checks["signing_keys"].Status)
+}
+
+func TestDrain(t *testing.T) {
+	c := New()
+	c.Add("mongo", func(ctx context.Context) error { return nil })
+
+	c.Drain()
+
+	code, report := ready(t, c)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, StatusDraining, report.Status)
+
+	rec := httptest.NewRecorder()
+	c.Live().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
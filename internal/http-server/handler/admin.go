@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/authz"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/service"
+	"gopkg.in/yaml.v3"
+)
+
+// adminScope grants access to the /admin API. Clients presenting a verified
+// TLS client certificate do not need a token.
+const adminScope = "admin"
+
+type Admin interface {
+	User(ctx context.Context, userName string) (service.User, error)
+	Sessions(ctx context.Context, userName string) ([]service.Session, error)
+	RevokeSessions(ctx context.Context, userName string, id string) error
+	LockUser(ctx context.Context, userName string, reason string, lockedBy string) error
+	UnlockUser(ctx context.Context, userName string) error
+}
+
+type KeyRotator interface {
+	Rotate(ctx context.Context) (auth.Key, error)
+}
+
+type AuditLog interface {
+	Query(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+func WithAdmin(admin Admin, keys KeyRotator) Option {
+	return func(h *Handler) {
+		h.admin = admin
+		h.keys = keys
+	}
+}
+
+// WithAudit serves the audit trail at /admin/audit.
+func WithAudit(log AuditLog) Option {
+	return func(h *Handler) {
+		h.audit = log
+	}
+}
+
+type lockRequest struct {
+	UserName string `json:"user_name"`
+	Reason   string `json:"reason"`
+}
+
+type rotatedKey struct {
+	KeyID     string    `json:"kid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *Handler) adminRoute(pattern string, next http.Handler) http.Handler {
+	tokenAuth := func(next http.Handler) http.Handler {
+		return authz.Authenticate(h.auth)(authz.RequireScope(adminScope)(next))
+	}
+
+	// Changes made through the admin API are audited as the operator's.
+	withActor := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(audit.WithActor(r.Context(), operator(r))))
+	})
+
+	return h.route(pattern, authz.ClientCertOr(h.cfg.HTTPServer.TLS.AdminCertificates, tokenAuth)(withActor))
+}
+
+func (h *Handler) adminUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userName, ok := getUserNameParam(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := h.admin.User(r.Context(), userName)
+		if err != nil {
+			renderAdminError(w, err)
+			return
+		}
+
+		if err := renderJSON(w, user); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// adminSessionsHandler lists a user's sessions with GET and revokes them with
+// DELETE, a single one if ?id= is given.
+func (h *Handler) adminSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userName, ok := getUserNameParam(w, r)
+		if !ok {
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := h.admin.RevokeSessions(r.Context(), userName, r.URL.Query().Get("id")); err != nil {
+				renderAdminError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		sessions, err := h.admin.Sessions(r.Context(), userName)
+		if err != nil {
+			renderAdminError(w, err)
+			return
+		}
+
+		if err := renderJSON(w, sessions); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// adminLockHandler locks a user with POST of a lockRequest and unlocks one
+// with DELETE ?user_name=.
+func (h *Handler) adminLockHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req lockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserName == "" {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			if err := h.admin.LockUser(r.Context(), req.UserName, req.Reason, operator(r)); err != nil {
+				renderAdminError(w, err)
+				return
+			}
+		case http.MethodDelete:
+			userName, ok := getUserNameParam(w, r)
+			if !ok {
+				return
+			}
+
+			if err := h.admin.UnlockUser(r.Context(), userName); err != nil {
+				renderAdminError(w, err)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) adminRotateKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, err := h.keys.Rotate(r.Context())
+		if err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := renderJSONStatus(w, http.StatusCreated, rotatedKey{KeyID: key.ID, CreatedAt: key.CreatedAt}); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// adminConfigHandler shows the running configuration as YAML, with secrets redacted.
+func (h *Handler) adminConfigHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := yaml.Marshal(h.cfg.Redacted())
+		if err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+	}
+}
+
+// adminAuditHandler lists audit events, newest first, optionally of one
+// ?user_name= and within ?from= and ?to= given in RFC 3339.
+func (h *Handler) adminAuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := models.AuditFilter{Subject: query.Get("user_name")}
+
+		var err error
+		if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+			http.Error(w, "Parameter 'from' is invalid", http.StatusBadRequest)
+			return
+		}
+		if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+			http.Error(w, "Parameter 'to' is invalid", http.StatusBadRequest)
+			return
+		}
+		if limit := query.Get("limit"); limit != "" {
+			if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || filter.Limit < 0 {
+				http.Error(w, "Parameter 'limit' is invalid", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := h.audit.Query(r.Context(), filter)
+		if err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := renderJSON(w, events); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func getUserNameParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userName := r.URL.Query().Get("user_name")
+	if userName == "" {
+		http.Error(w, "Parameter 'user_name' is missing", http.StatusBadRequest)
+		return "", false
+	}
+
+	return userName, true
+}
+
+// operator names who made an admin request, for the audit fields of a change.
+// A request with claims was let in by its token, even over a connection with
+// a client certificate.
+func operator(r *http.Request) string {
+	if claims, ok := authz.ClaimsFromContext(r.Context()); ok {
+		return claims.Subject
+	}
+
+	if cert := authz.ClientCertificate(r); cert != nil {
+		return "cert:" + cert.Subject.CommonName
+	}
+
+	return ""
+}
+
+func renderAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrUserNotLocked):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
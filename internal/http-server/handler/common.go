@@ -4,10 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/ZiganshinDev/medods/internal/dpop"
 )
 
 func renderJSON(w http.ResponseWriter, v interface{}) error {
+	return renderJSONStatus(w, http.StatusOK, v)
+}
+
+func renderJSONStatus(w http.ResponseWriter, status int, v interface{}) error {
 	const op = "http-server.handler.renderJSON"
 
 	js, err := json.Marshal(v)
@@ -16,6 +23,7 @@ func renderJSON(w http.ResponseWriter, v interface{}) error {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if _, err := w.Write(js); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -32,6 +40,21 @@ func getHeader(r *http.Request, header string) (string, error) {
 	return h, nil
 }
 
+func getBearerToken(r *http.Request) (string, error) {
+	h, err := getHeader(r, "Authorization")
+	if err != nil {
+		return "", err
+	}
+
+	for _, prefix := range []string{"Bearer ", dpop.Scheme + " "} {
+		if len(h) > len(prefix) && strings.EqualFold(h[:len(prefix)], prefix) {
+			return h[len(prefix):], nil
+		}
+	}
+
+	return "", fmt.Errorf("Authorization header is not a bearer token")
+}
+
 func setCookies(w http.ResponseWriter, refreshToken string, accessToken string, refreshTokenTTL time.Duration, accessTokenTTL time.Duration) {
 	httpOnlyCookie := http.Cookie{
 		Name:     "httpOnly_cookie",
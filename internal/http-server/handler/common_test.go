@@ -83,3 +83,20 @@ func TestGetHeaderError(t *testing.T) {
 	_, err := getHeader(req, missingHeaderName)
 	require.Error(t, err)
 }
+
+func TestGetBearerToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/oauth/authorize", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	value, err := getBearerToken(req)
+	require.NoError(t, err)
+	require.Equal(t, "token", value)
+}
+
+func TestGetBearerTokenError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/oauth/authorize", nil)
+	req.Header.Add("Authorization", "Basic dXNlcjpwYXNz")
+
+	_, err := getBearerToken(req)
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+)
+
+// sessionCookie carries the access token of a first-party session to
+// /oauth/authorize. Browsers reach it by redirect from a client, so they
+// cannot send an Authorization header.
+const sessionCookie = "session"
+
+// setSessionCookie sets the session cookie next to the cookies of setCookies.
+// SameSite=Lax keeps it out of cross-site requests other than navigation.
+func (h *Handler) setSessionCookie(w http.ResponseWriter, accessToken string, accessTokenTTL time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    accessToken,
+		Expires:  time.Now().Add(accessTokenTTL),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.JWT.Issuer, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Request.ClientID}}</title></head>
+<body>
+<p>Allow <b>{{.Request.ClientID}}</b> to access your account{{if .Request.Scope}} with scope <b>{{.Request.Scope}}</b>{{end}}?</p>
+<form method="post">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+type consent struct {
+	Request   oauth.AuthorizeRequest
+	CSRFToken string
+}
+
+// authorizeWithCookie is authorizeHandler for a user signed in with the
+// session cookie. Browsers send the cookie with navigations started by any
+// site, so the user has to approve the request first, with a form that
+// carries a token only a page of this server knows.
+func (h *Handler) authorizeWithCookie(w http.ResponseWriter, r *http.Request, redirectURI string, req oauth.AuthorizeRequest) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		redirectOAuthError(w, r, redirectURI, req.State, oauth.NewError(oauth.ErrAccessDenied, "user is not authenticated"))
+		return
+	}
+
+	claims, err := h.verifyUserToken(r, cookie.Value)
+	if err != nil || claims.AuthTime == 0 {
+		redirectOAuthError(w, r, redirectURI, req.State, oauth.NewError(oauth.ErrAccessDenied, "user is not authenticated"))
+		return
+	}
+
+	token := csrfToken(cookie.Value)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+		w.Header().Set("X-Frame-Options", "DENY")
+
+		if err := consentPage.Execute(w, consent{Request: req, CSRFToken: token}); err != nil {
+			logger.SetError(r.Context(), err)
+		}
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("csrf_token")), []byte(token)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.PostForm.Get("action") != "approve" {
+		redirectOAuthError(w, r, redirectURI, req.State, oauth.NewError(oauth.ErrAccessDenied, "user denied the request"))
+		return
+	}
+
+	h.issueCode(w, r, claims.Subject, claims.AuthenticatedAt(), redirectURI, req)
+}
+
+// csrfToken is the CSRF token of the consent form of a session. It can only be
+// computed with the session cookie, which pages of other sites cannot read.
+func csrfToken(session string) string {
+	sum := sha256.Sum256([]byte("oauth authorize csrf:" + session))
+
+	return hex.EncodeToString(sum[:])
+}
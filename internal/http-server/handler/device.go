@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+)
+
+type Device interface {
+	DeviceAuthorization(ctx context.Context, creds oauth.ClientCredentials, scope string) (oauth.DeviceAuthorizationResponse, error)
+	DeviceVerification(ctx context.Context, userCode string) (oauth.DeviceVerification, error)
+	ApproveDevice(ctx context.Context, userName string, authTime time.Time, userCode string, approve bool) error
+}
+
+type deviceApproval struct {
+	UserCode string `json:"user_code"`
+	Status   string `json:"status"`
+}
+
+func (h *Handler) deviceCodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		creds, err := getClientCredentials(r)
+		if err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		resp, err := h.oauth.DeviceAuthorization(r.Context(), creds, r.PostForm.Get("scope"))
+		if err != nil {
+			renderClientError(w, creds, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := renderJSON(w, resp); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// deviceVerificationHandler lets a signed-in user look up a user code with GET
+// and approve or deny it with POST action=approve|deny.
+func (h *Handler) deviceVerificationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, err := h.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		userCode := r.Form.Get("user_code")
+
+		if r.Method == http.MethodGet {
+			verification, err := h.oauth.DeviceVerification(r.Context(), userCode)
+			if err != nil {
+				renderOAuthError(w, err)
+				return
+			}
+
+			if err := renderJSON(w, verification); err != nil {
+				logger.SetError(r.Context(), err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		var approve bool
+		switch r.PostForm.Get("action") {
+		case "approve":
+			approve = true
+		case "deny":
+		default:
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "action must be approve or deny"))
+			return
+		}
+
+		if err := h.oauth.ApproveDevice(r.Context(), claims.Subject, claims.AuthenticatedAt(), userCode, approve); err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		status := "denied"
+		if approve {
+			status = "approved"
+		}
+
+		if err := renderJSON(w, deviceApproval{UserCode: oauth.NormalizeUserCode(userCode), Status: status}); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
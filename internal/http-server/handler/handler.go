@@ -1,27 +1,113 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
 	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/dpop"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/authz"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/requestid"
+	"github.com/ZiganshinDev/medods/internal/service"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/ZiganshinDev/medods/internal/tracing"
 )
 
 type Auth interface {
 	GetRefreshToken(userName string) (string, error)
-	GetAccessToken(userName string) (string, error)
-	ValidToken(refreshToken string, userName string) bool
-	CheckCountTokensByUser(userName string) error
-	InsertToken(refreshToken string, userName string) error
-	SwitchToken(newToken string, userName string) error
+	GetAccessToken(ctx context.Context, userName string) (string, error)
+	ValidToken(ctx context.Context, refreshToken string, userName string) bool
+	CheckCountTokensByUser(ctx context.Context, userName string) error
+	InsertToken(ctx context.Context, refreshToken string, userName string) error
+	SwitchToken(ctx context.Context, oldToken string, newToken string) error
+	VerifyAccessToken(ctx context.Context, accessToken string) (*auth.CustomClaims, error)
+	CheckUserActive(ctx context.Context, userName string) error
 }
 
 type Logger func(http.Handler) http.Handler
 
+// Tenancy puts the tenant of a request in its context.
+type Tenancy func(http.Handler) http.Handler
+
+type RateLimiter interface {
+	Middleware(route string) func(http.Handler) http.Handler
+}
+
+type Metrics interface {
+	Middleware(route string) func(http.Handler) http.Handler
+	Handler() http.Handler
+}
+
+// Health serves the liveness and readiness probes.
+type Health interface {
+	Live() http.Handler
+	Ready() http.Handler
+}
+
+// DPoP verifies DPoP proofs of RFC 9449.
+type DPoP interface {
+	Verify(ctx context.Context, proof string, method string, requestURL string) (dpop.Proof, error)
+}
+
 type Handler struct {
-	cfg    *config.Config
-	auth   Auth
-	logger Logger
+	cfg         *config.Config
+	auth        Auth
+	logger      Logger
+	rateLimiter RateLimiter
+	oauth       OAuth
+	rbac        RBAC
+	policy      Policy
+	tenancy     Tenancy
+	admin       Admin
+	keys        KeyRotator
+	metrics     Metrics
+	audit       AuditLog
+	health      Health
+	dpop        DPoP
+}
+
+type Option func(*Handler)
+
+func WithRateLimiter(rl RateLimiter) Option {
+	return func(h *Handler) {
+		h.rateLimiter = rl
+	}
+}
+
+func WithTenancy(t Tenancy) Option {
+	return func(h *Handler) {
+		h.tenancy = t
+	}
+}
+
+// WithMetrics records request latency for every route and serves the metrics
+// at cfg.Metrics.Path.
+func WithMetrics(m Metrics) Option {
+	return func(h *Handler) {
+		h.metrics = m
+	}
+}
+
+// WithHealth serves /healthz and /readyz. They bypass the middlewares so that
+// probes are neither rate limited nor logged.
+func WithHealth(health Health) Option {
+	return func(h *Handler) {
+		h.health = health
+	}
+}
+
+// WithDPoP checks the DPoP proofs sent to any route and binds the tokens
+// issued with one to its key.
+func WithDPoP(d DPoP) Option {
+	return func(h *Handler) {
+		h.dpop = d
+	}
 }
 
 type response struct {
@@ -30,26 +116,114 @@ type response struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func New(cfg *config.Config, auth Auth, logger Logger) *Handler {
-	return &Handler{
+func New(cfg *config.Config, auth Auth, logger Logger, opts ...Option) *Handler {
+	h := &Handler{
 		cfg:    cfg,
 		auth:   auth,
 		logger: logger,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
 }
 
 func (h *Handler) NewRouter() http.Handler {
 	router := http.NewServeMux()
 
-	authHandlerWithLogger := h.logger(h.authHandler())
-	router.Handle("/auth", authHandlerWithLogger)
+	router.Handle("/auth", h.route("/auth", h.authHandler()))
+	router.Handle("/refresh", h.route("/refresh", h.refreshHandler()))
+
+	if h.oauth != nil {
+		router.Handle("/oauth/authorize", h.route("/oauth/authorize", h.authorizeHandler()))
+		router.Handle("/oauth/token", h.route("/oauth/token", h.tokenHandler()))
+		router.Handle("/introspect", h.route("/introspect", h.introspectHandler()))
+		router.Handle("/device/code", h.route("/device/code", h.deviceCodeHandler()))
+		router.Handle("/device", h.route("/device", h.deviceVerificationHandler()))
+		router.Handle("/revoke", h.route("/revoke", h.revokeHandler()))
+		router.Handle("/userinfo", h.route("/userinfo", h.userInfoHandler()))
+		router.Handle("/.well-known/openid-configuration", h.route("/.well-known/openid-configuration", h.discoveryHandler()))
+		router.Handle("/.well-known/jwks.json", h.route("/.well-known/jwks.json", h.jwksHandler()))
+	}
+
+	if h.rbac != nil {
+		router.Handle("/admin/roles", h.protectedRoute("/admin/roles", permissionManageRoles, h.rolesHandler()))
+		router.Handle("/admin/users/roles", h.protectedRoute("/admin/users/roles", permissionAssignRoles, h.userRolesHandler()))
+	}
+
+	if h.admin != nil {
+		router.Handle("/admin/users", h.adminRoute("/admin/users", h.adminUserHandler()))
+		router.Handle("/admin/users/sessions", h.adminRoute("/admin/users/sessions", h.adminSessionsHandler()))
+		router.Handle("/admin/users/lock", h.adminRoute("/admin/users/lock", h.adminLockHandler()))
+		router.Handle("/admin/keys/rotate", h.adminRoute("/admin/keys/rotate", h.adminRotateKeyHandler()))
+		router.Handle("/admin/config", h.adminRoute("/admin/config", h.adminConfigHandler()))
+	}
+
+	if h.audit != nil {
+		router.Handle("/admin/audit", h.adminRoute("/admin/audit", h.adminAuditHandler()))
+	}
+
+	if h.policy != nil {
+		router.Handle("/authorize", h.protectedRoute("/authorize", permissionDecide, h.decisionHandler()))
+	}
+
+	if h.metrics != nil {
+		router.Handle(h.cfg.Metrics.Path, h.metrics.Handler())
+	}
 
-	refreshHandlerWithLogger := h.logger(h.refreshHandler())
-	router.Handle("/refresh", refreshHandlerWithLogger)
+	if h.health != nil {
+		router.Handle("/healthz", h.health.Live())
+		router.Handle("/readyz", h.health.Ready())
+	}
 
 	return router
 }
 
+func (h *Handler) route(pattern string, next http.Handler) http.Handler {
+	if h.rateLimiter != nil {
+		next = h.rateLimiter.Middleware(pattern)(next)
+	}
+
+	if h.tenancy != nil {
+		next = h.tenancy(next)
+	}
+
+	if h.metrics != nil {
+		next = h.metrics.Middleware(pattern)(next)
+	}
+
+	if h.cfg.Tracing.Enabled {
+		next = tracing.Middleware(pattern)(next)
+	}
+
+	if h.dpop != nil {
+		next = authz.DPoP(h.dpop, h.cfg.JWT.Issuer)(next)
+	}
+
+	next = authz.BindCertificate(next)
+
+	return requestid.Middleware(h.logger(audit.Middleware(next)))
+}
+
+// protectedRoute is route for handlers that need a verified access token
+// granting permission.
+func (h *Handler) protectedRoute(pattern string, permission string, next http.Handler) http.Handler {
+	next = authz.RequirePermission(permission)(next)
+	next = authz.Authenticate(h.auth)(next)
+
+	return h.route(pattern, next)
+}
+
+func (h *Handler) accessTokenTTL(r *http.Request) time.Duration {
+	return tenant.AccessTokenTTL(r.Context(), h.cfg.AccessTokenTTL)
+}
+
+func (h *Handler) refreshTokenTTL(r *http.Request) time.Duration {
+	return tenant.RefreshTokenTTL(r.Context(), h.cfg.RefreshTokenTTL)
+}
+
 const (
 	name  = "Name"
 	token = "Token"
@@ -68,29 +242,40 @@ func (h *Handler) authHandler() http.HandlerFunc {
 			return
 		}
 
-		if err := h.auth.CheckCountTokensByUser(userName); err != nil {
+		logger.SetUser(r.Context(), userName)
+
+		if !h.checkUserActive(w, r, userName) {
+			return
+		}
+
+		if err := h.auth.CheckCountTokensByUser(r.Context(), userName); err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		refreshToken, err := h.auth.GetRefreshToken(userName)
 		if err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if err := h.auth.InsertToken(refreshToken, userName); err != nil {
+		if err := h.auth.InsertToken(r.Context(), refreshToken, userName); err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		accessToken, err := h.auth.GetAccessToken(userName)
+		accessToken, err := h.auth.GetAccessToken(r.Context(), userName)
 		if err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		setCookies(w, refreshToken, accessToken, h.cfg.RefreshTokenTTL, h.cfg.AccessTokenTTL)
+		setCookies(w, refreshToken, accessToken, h.refreshTokenTTL(r), h.accessTokenTTL(r))
+		h.setSessionCookie(w, accessToken, h.accessTokenTTL(r))
 
 		response := response{
 			Name:         userName,
@@ -99,6 +284,7 @@ func (h *Handler) authHandler() http.HandlerFunc {
 		}
 
 		if err := renderJSON(w, response); err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -124,29 +310,44 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 			return
 		}
 
-		if ok := h.auth.ValidToken(refreshTokenFromHeader, userName); !ok {
+		logger.SetUser(r.Context(), userName)
+
+		if ok := h.auth.ValidToken(r.Context(), refreshTokenFromHeader, userName); !ok {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
+		if !h.checkUserActive(w, r, userName) {
+			return
+		}
+
 		newRefreshToken, err := h.auth.GetRefreshToken(userName)
 		if err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if err := h.auth.SwitchToken(newRefreshToken, userName); err != nil {
+		err = h.auth.SwitchToken(r.Context(), refreshTokenFromHeader, newRefreshToken)
+		if errors.Is(err, service.ErrTokenReused) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		accessToken, err := h.auth.GetAccessToken(userName)
+		accessToken, err := h.auth.GetAccessToken(r.Context(), userName)
 		if err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		setCookies(w, newRefreshToken, accessToken, h.cfg.RefreshTokenTTL, h.cfg.AccessTokenTTL)
+		setCookies(w, newRefreshToken, accessToken, h.refreshTokenTTL(r), h.accessTokenTTL(r))
+		h.setSessionCookie(w, accessToken, h.accessTokenTTL(r))
 
 		response := response{
 			Name:         userName,
@@ -155,8 +356,24 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 		}
 
 		if err := renderJSON(w, response); err != nil {
+			logger.SetError(r.Context(), err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+func (h *Handler) checkUserActive(w http.ResponseWriter, r *http.Request, userName string) bool {
+	err := h.auth.CheckUserActive(r.Context(), userName)
+	if errors.Is(err, service.ErrUserLocked) {
+		http.Error(w, "User is locked", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		logger.SetError(r.Context(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
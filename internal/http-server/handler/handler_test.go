@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/metrics"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+// newRouterHandler is a Handler with every middleware that wraps the
+// response writer turned on.
+func newRouterHandler() *Handler {
+	cfg := &config.Config{
+		Metrics: config.Metrics{Enabled: true, Path: "/metrics"},
+		Tracing: config.Tracing{Enabled: true},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return New(cfg, fakeAuth{}, logger.New(log), WithMetrics(metrics.New()))
+}
+
+func TestRouterForwardsStatus(t *testing.T) {
+	srv := httptest.NewServer(newRouterHandler().NewRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/auth")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `code="400",method="GET",route="/auth"`)
+}
+
+// TestRouteKeepsWriterInterfaces goes through route, which NewRouter mounts
+// every endpoint with, so each wrapper of the writer is in the way.
+func TestRouteKeepsWriterInterfaces(t *testing.T) {
+	h := newRouterHandler()
+
+	flush := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		require.True(t, ok)
+
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, "flushed")
+		require.NoError(t, http.NewResponseController(w).Flush())
+	})
+
+	hijack := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, _ = buf.WriteString("HTTP/1.1 204 No Content\r\nX-Probe: hijacked\r\nConnection: close\r\n\r\n")
+		require.NoError(t, buf.Flush())
+	})
+
+	router := http.NewServeMux()
+	router.Handle("/flush", h.route("/flush", flush))
+	router.Handle("/hijack", h.route("/hijack", hijack))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/flush")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "flushed", string(body))
+
+	resp, err = http.Get(srv.URL + "/hijack")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "hijacked", resp.Header.Get("X-Probe"))
+}
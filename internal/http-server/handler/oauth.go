@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/authz"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+)
+
+type OAuth interface {
+	Device
+
+	ResolveRedirectURI(ctx context.Context, clientID string, redirectURI string) (string, error)
+	Authorize(ctx context.Context, userName string, authTime time.Time, req oauth.AuthorizeRequest) (string, error)
+	Token(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error)
+	UserInfo(ctx context.Context, claims *auth.CustomClaims) (oauth.UserInfo, error)
+	Introspect(ctx context.Context, creds oauth.ClientCredentials, token string, hint string) (oauth.IntrospectionResponse, error)
+	Revoke(ctx context.Context, creds oauth.ClientCredentials, token string, hint string) error
+	Discovery() oauth.ProviderMetadata
+	JWKS() auth.JWKS
+}
+
+func WithOAuth(o OAuth) Option {
+	return func(h *Handler) {
+		h.oauth = o
+	}
+}
+
+func (h *Handler) authorizeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		req := oauth.AuthorizeRequest{
+			ResponseType:        r.Form.Get("response_type"),
+			ClientID:            r.Form.Get("client_id"),
+			RedirectURI:         r.Form.Get("redirect_uri"),
+			Scope:               r.Form.Get("scope"),
+			State:               r.Form.Get("state"),
+			CodeChallenge:       r.Form.Get("code_challenge"),
+			CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+			Nonce:               r.Form.Get("nonce"),
+		}
+
+		redirectURI, err := h.oauth.ResolveRedirectURI(r.Context(), req.ClientID, req.RedirectURI)
+		if err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		if r.Header.Get("Authorization") == "" {
+			h.authorizeWithCookie(w, r, redirectURI, req)
+			return
+		}
+
+		// The ID token reports auth_time, so a session that does not know
+		// when the user authenticated cannot authorize.
+		claims, err := h.authenticate(r)
+		if err != nil || claims.AuthTime == 0 {
+			redirectOAuthError(w, r, redirectURI, req.State, oauth.NewError(oauth.ErrAccessDenied, "user is not authenticated"))
+			return
+		}
+
+		h.issueCode(w, r, claims.Subject, claims.AuthenticatedAt(), redirectURI, req)
+	}
+}
+
+func (h *Handler) issueCode(w http.ResponseWriter, r *http.Request, userName string, authTime time.Time, redirectURI string, req oauth.AuthorizeRequest) {
+	code, err := h.oauth.Authorize(r.Context(), userName, authTime, req)
+	if err != nil {
+		redirectOAuthError(w, r, redirectURI, req.State, err)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+func (h *Handler) tokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		creds, err := getClientCredentials(r)
+		if err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		req := oauth.TokenRequest{
+			GrantType:    r.PostForm.Get("grant_type"),
+			Client:       creds,
+			Scope:        r.PostForm.Get("scope"),
+			Code:         r.PostForm.Get("code"),
+			RedirectURI:  r.PostForm.Get("redirect_uri"),
+			CodeVerifier: r.PostForm.Get("code_verifier"),
+			DeviceCode:   r.PostForm.Get("device_code"),
+			RefreshToken: r.PostForm.Get("refresh_token"),
+
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			ActorToken:         r.PostForm.Get("actor_token"),
+			ActorTokenType:     r.PostForm.Get("actor_token_type"),
+			Audience:           r.PostForm.Get("audience"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+		}
+
+		resp, err := h.oauth.Token(r.Context(), req)
+		if err != nil {
+			renderClientError(w, creds, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		if err := renderJSON(w, resp); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (h *Handler) introspectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		creds, err := getClientCredentials(r)
+		if err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		resp, err := h.oauth.Introspect(r.Context(), creds, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+		if err != nil {
+			renderClientError(w, creds, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := renderJSON(w, resp); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (h *Handler) revokeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			renderOAuthError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request"))
+			return
+		}
+
+		creds, err := getClientCredentials(r)
+		if err != nil {
+			renderOAuthError(w, err)
+			return
+		}
+
+		if err := h.oauth.Revoke(r.Context(), creds, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint")); err != nil {
+			renderClientError(w, creds, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *Handler) authenticate(r *http.Request) (*auth.CustomClaims, error) {
+	accessToken, err := getBearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.verifyUserToken(r, accessToken)
+}
+
+// verifyUserToken verifies an access token of a user session sent with r.
+func (h *Handler) verifyUserToken(r *http.Request, accessToken string) (*auth.CustomClaims, error) {
+	claims, err := h.auth.VerifyAccessToken(r.Context(), accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authz.CheckConfirmation(r, accessToken, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Machine() {
+		return nil, fmt.Errorf("%w: client token is not a user session", auth.ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// getClientCredentials reads client authentication sent either with HTTP Basic
+// or as client_id and client_secret form parameters. Using both is an error.
+// Without a secret, a client_id sent over a connection with a verified client
+// certificate uses tls_client_auth.
+func getClientCredentials(r *http.Request) (oauth.ClientCredentials, error) {
+	id, secret, basic := r.BasicAuth()
+	postID, postSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+
+	if basic {
+		if postSecret != "" {
+			return oauth.ClientCredentials{}, oauth.NewError(oauth.ErrInvalidRequest, "multiple client authentication methods")
+		}
+
+		// RFC 6749 section 2.3.1 requires form-urlencoding of both parts.
+		clientID, idErr := url.QueryUnescape(id)
+		clientSecret, secretErr := url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return oauth.ClientCredentials{}, oauth.NewError(oauth.ErrInvalidClient, "malformed credentials")
+		}
+
+		if postID != "" && postID != clientID {
+			return oauth.ClientCredentials{}, oauth.NewError(oauth.ErrInvalidRequest, "client_id mismatch")
+		}
+
+		return oauth.ClientCredentials{ID: clientID, Secret: clientSecret, Method: oauth.AuthMethodBasic}, nil
+	}
+
+	if postSecret != "" {
+		return oauth.ClientCredentials{ID: postID, Secret: postSecret, Method: oauth.AuthMethodPost}, nil
+	}
+
+	if cert := authz.ClientCertificate(r); cert != nil {
+		return oauth.ClientCredentials{ID: postID, Method: oauth.AuthMethodTLSClient, Certificate: cert}, nil
+	}
+
+	return oauth.ClientCredentials{ID: postID, Method: oauth.AuthMethodNone}, nil
+}
+
+func renderClientError(w http.ResponseWriter, creds oauth.ClientCredentials, err error) {
+	if creds.Method == oauth.AuthMethodBasic && oauth.AsError(err).Code == oauth.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	renderOAuthError(w, err)
+}
+
+func renderOAuthError(w http.ResponseWriter, err error) {
+	oerr := oauth.AsError(err)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := renderJSONStatus(w, oerr.Status(), oerr); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, redirectURI string, state string, err error) {
+	oerr := oauth.AsError(err)
+
+	params := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		logger.SetError(r.Context(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
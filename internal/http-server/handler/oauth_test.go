@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newFormRequest(t *testing.T, form url.Values) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.NoError(t, req.ParseForm())
+
+	return req
+}
+
+func TestGetClientCredentialsBasic(t *testing.T) {
+	req := newFormRequest(t, url.Values{})
+	req.SetBasicAuth("service%3Aa", "s%40cret")
+
+	creds, err := getClientCredentials(req)
+	require.NoError(t, err)
+	require.Equal(t, oauth.ClientCredentials{ID: "service:a", Secret: "s@cret", Method: oauth.AuthMethodBasic}, creds)
+}
+
+func TestGetClientCredentialsPost(t *testing.T) {
+	req := newFormRequest(t, url.Values{"client_id": {"service"}, "client_secret": {"secret"}})
+
+	creds, err := getClientCredentials(req)
+	require.NoError(t, err)
+	require.Equal(t, oauth.ClientCredentials{ID: "service", Secret: "secret", Method: oauth.AuthMethodPost}, creds)
+}
+
+func TestGetClientCredentialsPublic(t *testing.T) {
+	req := newFormRequest(t, url.Values{"client_id": {"web"}})
+
+	creds, err := getClientCredentials(req)
+	require.NoError(t, err)
+	require.Equal(t, oauth.ClientCredentials{ID: "web", Method: oauth.AuthMethodNone}, creds)
+}
+
+func TestGetClientCredentialsTLS(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+
+	req := newFormRequest(t, url.Values{"client_id": {"billing"}})
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	creds, err := getClientCredentials(req)
+	require.NoError(t, err)
+	require.Equal(t, oauth.ClientCredentials{ID: "billing", Method: oauth.AuthMethodTLSClient, Certificate: cert}, creds)
+}
+
+func TestGetClientCredentialsError(t *testing.T) {
+	req := newFormRequest(t, url.Values{"client_secret": {"secret"}})
+	req.SetBasicAuth("service", "secret")
+
+	_, err := getClientCredentials(req)
+	require.Error(t, err)
+	require.Equal(t, oauth.ErrInvalidRequest, oauth.AsError(err).Code)
+}
+
+type fakeAuth struct {
+	Auth
+	claims map[string]*auth.CustomClaims
+}
+
+func (f fakeAuth) VerifyAccessToken(_ context.Context, accessToken string) (*auth.CustomClaims, error) {
+	claims, ok := f.claims[accessToken]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func TestAuthenticateRejectsClientTokens(t *testing.T) {
+	h := &Handler{auth: fakeAuth{claims: map[string]*auth.CustomClaims{
+		"user":    {StandardClaims: jwt.StandardClaims{Subject: "alice"}, ClientID: "web"},
+		"machine": {StandardClaims: jwt.StandardClaims{Subject: "billing"}, ClientID: "billing"},
+	}}}
+
+	req := httptest.NewRequest("GET", "/oauth/authorize", nil)
+	req.Header.Set("Authorization", "Bearer user")
+	claims, err := h.authenticate(req)
+	require.NoError(t, err)
+	require.Equal(t, "alice", claims.Subject)
+
+	req = httptest.NewRequest("GET", "/oauth/authorize", nil)
+	req.Header.Set("Authorization", "Bearer machine")
+	_, err = h.authenticate(req)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+type fakeOAuth struct {
+	OAuth
+}
+
+func (fakeOAuth) ResolveRedirectURI(_ context.Context, _ string, redirectURI string) (string, error) {
+	return redirectURI, nil
+}
+
+func (fakeOAuth) Authorize(_ context.Context, userName string, _ time.Time, _ oauth.AuthorizeRequest) (string, error) {
+	return "code-for-" + userName, nil
+}
+
+func (fakeOAuth) UserInfo(_ context.Context, claims *auth.CustomClaims) (oauth.UserInfo, error) {
+	return oauth.UserInfo{Subject: claims.Subject}, nil
+}
+
+func TestUserInfoVerifiesToken(t *testing.T) {
+	// fakeAuth stands in for VerifyAccessToken, which refuses revoked
+	// tokens and locked users.
+	h := &Handler{
+		auth: fakeAuth{claims: map[string]*auth.CustomClaims{
+			"valid": {StandardClaims: jwt.StandardClaims{Subject: "alice"}},
+			"bound": {StandardClaims: jwt.StandardClaims{Subject: "alice"}, Cnf: &auth.Confirmation{JKT: "key"}},
+		}},
+		oauth: fakeOAuth{},
+	}
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{header: "Bearer valid", status: http.StatusOK},
+		{header: "Bearer revoked", status: http.StatusUnauthorized},
+		{header: "Bearer bound", status: http.StatusUnauthorized},
+		{header: "DPoP bound", status: http.StatusUnauthorized},
+		{header: "", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/userinfo", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		rec := httptest.NewRecorder()
+		h.userInfoHandler().ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.header)
+	}
+}
+
+func TestAuthorizeWithSessionCookie(t *testing.T) {
+	h := &Handler{
+		auth: fakeAuth{claims: map[string]*auth.CustomClaims{
+			"session": {StandardClaims: jwt.StandardClaims{Subject: "alice"}, AuthTime: time.Now().Unix()},
+		}},
+		oauth: fakeOAuth{},
+	}
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"web"},
+		"redirect_uri":  {"https://app.example.com/cb"},
+		"state":         {"xyz"},
+	}
+
+	authorize := func(method string, form url.Values, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/oauth/authorize?"+params.Encode(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie})
+		}
+
+		rec := httptest.NewRecorder()
+		h.authorizeHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := authorize("GET", nil, "")
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Contains(t, rec.Header().Get("Location"), "error=access_denied")
+
+	// With the cookie the user is asked first, in a page that cannot be framed.
+	rec = authorize("GET", nil, "session")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	require.Contains(t, rec.Body.String(), csrfToken("session"))
+
+	// A form posted from another site does not know the CSRF token.
+	rec = authorize("POST", url.Values{"action": {"approve"}}, "session")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = authorize("POST", url.Values{"action": {"approve"}, "csrf_token": {csrfToken("other")}}, "session")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = authorize("POST", url.Values{"action": {"deny"}, "csrf_token": {csrfToken("session")}}, "session")
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Contains(t, rec.Header().Get("Location"), "error=access_denied")
+
+	rec = authorize("POST", url.Values{"action": {"approve"}, "csrf_token": {csrfToken("session")}}, "session")
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Equal(t, "https://app.example.com/cb?code=code-for-alice&state=xyz", rec.Header().Get("Location"))
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/authz"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+)
+
+func (h *Handler) userInfoHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, err := getBearerToken(r); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := h.authenticate(r)
+		if err != nil {
+			logger.SetError(r.Context(), err)
+			renderBearerError(w, r, oauth.NewError(oauth.ErrInvalidToken, ""))
+			return
+		}
+
+		info, err := h.oauth.UserInfo(r.Context(), claims)
+		if err != nil {
+			renderBearerError(w, r, err)
+			return
+		}
+
+		if err := renderJSON(w, info); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (h *Handler) discoveryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := renderJSON(w, h.oauth.Discovery()); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (h *Handler) jwksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := renderJSON(w, h.oauth.JWKS()); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// renderBearerError answers a protected resource request as described in RFC 6750 section 3,
+// with the DPoP scheme for requests that used it.
+func renderBearerError(w http.ResponseWriter, r *http.Request, err error) {
+	oerr := oauth.AsError(err)
+
+	if oerr.Status() == http.StatusUnauthorized || oerr.Status() == http.StatusForbidden {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s error="%s"`, authz.Scheme(r), oerr.Code))
+	}
+
+	renderOAuthError(w, oerr)
+}
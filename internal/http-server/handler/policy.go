@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/policy"
+)
+
+const permissionDecide = "policy:decide"
+
+type Policy interface {
+	Decide(in policy.Input) policy.Decision
+}
+
+func WithPolicy(p Policy) Option {
+	return func(h *Handler) {
+		h.policy = p
+	}
+}
+
+// decisionRequest asks whether the bearer of SubjectToken may perform Action.
+// The subject attributes always come from the verified token.
+type decisionRequest struct {
+	SubjectToken string                 `json:"subject_token"`
+	Action       string                 `json:"action"`
+	Resource     map[string]interface{} `json:"resource"`
+	Context      map[string]interface{} `json:"context"`
+}
+
+func (h *Handler) decisionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req decisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if req.SubjectToken == "" || req.Action == "" {
+			http.Error(w, "Fields 'subject_token' and 'action' are required", http.StatusBadRequest)
+			return
+		}
+
+		decision := policy.Decision{Allowed: false, Reason: "subject token is not active"}
+
+		claims, err := h.auth.VerifyAccessToken(r.Context(), req.SubjectToken)
+		if err == nil {
+			decision = h.policy.Decide(policy.Input{
+				Subject:  policy.SubjectFromClaims(claims),
+				Action:   req.Action,
+				Resource: req.Resource,
+				Context:  req.Context,
+			})
+		}
+
+		if err := renderJSON(w, decision); err != nil {
+			logger.SetError(r.Context(), err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/service"
+)
+
+const (
+	permissionManageRoles = "rbac:roles"
+	permissionAssignRoles = "rbac:assign"
+)
+
+type RBAC interface {
+	Roles(ctx context.Context) ([]models.Role, error)
+	SaveRole(ctx context.Context, role models.Role) error
+	DeleteRole(ctx context.Context, name string) error
+	UserRoles(ctx context.Context, userName string) ([]string, error)
+	AssignRole(ctx context.Context, userName string, role string) error
+	UnassignRole(ctx context.Context, userName string, role string) error
+}
+
+func WithRBAC(rbac RBAC) Option {
+	return func(h *Handler) {
+		h.rbac = rbac
+	}
+}
+
+type roleAssignment struct {
+	UserName string `json:"user_name"`
+	Role     string `json:"role"`
+}
+
+// rolesHandler lists roles with GET, creates or replaces one with PUT and
+// deletes one with DELETE ?name=.
+func (h *Handler) rolesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			roles, err := h.rbac.Roles(r.Context())
+			if err != nil {
+				renderRBACError(w, err)
+				return
+			}
+
+			if err := renderJSON(w, roles); err != nil {
+				logger.SetError(r.Context(), err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPut:
+			var role models.Role
+			if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			if err := h.rbac.SaveRole(r.Context(), role); err != nil {
+				renderRBACError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if err := h.rbac.DeleteRole(r.Context(), r.URL.Query().Get("name")); err != nil {
+				renderRBACError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// userRolesHandler shows a user's roles with GET ?user_name=, and assigns or
+// takes away a role with POST or DELETE of a roleAssignment. Roles are only
+// assigned to clients, named "client:<id>"; other names get 400.
+func (h *Handler) userRolesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userName := r.URL.Query().Get("user_name")
+			if userName == "" {
+				http.Error(w, "Parameter 'user_name' is missing", http.StatusBadRequest)
+				return
+			}
+
+			roles, err := h.rbac.UserRoles(r.Context(), userName)
+			if err != nil {
+				renderRBACError(w, err)
+				return
+			}
+
+			if err := renderJSON(w, models.UserRoles{UserName: userName, Roles: roles}); err != nil {
+				logger.SetError(r.Context(), err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPost, http.MethodDelete:
+			var req roleAssignment
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			var err error
+			if r.Method == http.MethodPost {
+				err = h.rbac.AssignRole(r.Context(), req.UserName, req.Role)
+			} else {
+				err = h.rbac.UnassignRole(r.Context(), req.UserName, req.Role)
+			}
+			if err != nil {
+				renderRBACError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func renderRBACError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRole):
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
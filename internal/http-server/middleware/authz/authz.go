@@ -0,0 +1,378 @@
+package authz
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/dpop"
+	"github.com/ZiganshinDev/medods/internal/http-server/middleware/logger"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/policy"
+)
+
+type Verifier interface {
+	VerifyAccessToken(ctx context.Context, accessToken string) (*auth.CustomClaims, error)
+}
+
+type claimsKey struct{}
+
+func NewContext(ctx context.Context, claims *auth.CustomClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*auth.CustomClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*auth.CustomClaims)
+	return claims, ok && claims != nil
+}
+
+// Authenticate verifies the bearer token of a request and puts its claims in
+// the request context. Requests without a valid token get 401.
+func Authenticate(v Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := v.VerifyAccessToken(r.Context(), accessToken)
+			if err == nil {
+				err = CheckConfirmation(r, accessToken, claims)
+			}
+			if err != nil {
+				logger.SetError(r.Context(), err)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s error="invalid_token"`, Scheme(r)))
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			logger.SetUser(r.Context(), claims.Subject)
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// RequirePermission lets a request through only if the claims put in the
+// context by Authenticate grant permission.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !HasPermission(claims.Permissions, permission) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope lets a request through only if the claims put in the context
+// by Authenticate include scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !oauth.HasScope(claims.Scope, scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientCertOr lets requests with a verified TLS client certificate in
+// allowed, by subject common name or thumbprint, straight through to next and
+// sends the others through fallback first. Any certificate from the client CA
+// verifies, OAuth clients' included, so one that is not allowed and comes
+// without a token is forbidden.
+func ClientCertOr(allowed []string, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		guarded := fallback(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := ClientCertificate(r)
+
+			switch {
+			case cert != nil && certificateAllowed(cert, allowed):
+				next.ServeHTTP(w, r)
+			case cert != nil && r.Header.Get("Authorization") == "":
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			default:
+				guarded.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func certificateAllowed(cert *x509.Certificate, allowed []string) bool {
+	thumbprint := auth.CertificateThumbprint(cert)
+
+	for _, a := range allowed {
+		if a == "" {
+			continue
+		}
+
+		if a == cert.Subject.CommonName || subtle.ConstantTimeCompare([]byte(a), []byte(thumbprint)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BindCertificate puts the verified TLS client certificate of a request in its
+// context as a confirmation, so that access tokens issued while serving it are
+// bound to the certificate (RFC 8705 section 3).
+func BindCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cert := ClientCertificate(r); cert != nil {
+			cnf := auth.Confirmation{X5tS256: auth.CertificateThumbprint(cert)}
+			r = r.WithContext(auth.NewConfirmationContext(r.Context(), cnf))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckConfirmation makes sure a sender-constrained token is used by the
+// client it was issued to: a certificate-bound token must come over a
+// connection with the same client certificate, and a DPoP-bound token with
+// the DPoP scheme and a proof of the same key for accessToken.
+func CheckConfirmation(r *http.Request, accessToken string, claims *auth.CustomClaims) error {
+	var cnf auth.Confirmation
+	if claims.Cnf != nil {
+		cnf = *claims.Cnf
+	}
+
+	if cnf.X5tS256 != "" {
+		cert := ClientCertificate(r)
+		if cert == nil {
+			return fmt.Errorf("%w: certificate-bound token sent without a client certificate", auth.ErrInvalidToken)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(auth.CertificateThumbprint(cert)), []byte(cnf.X5tS256)) != 1 {
+			return fmt.Errorf("%w: token is bound to another certificate", auth.ErrInvalidToken)
+		}
+	}
+
+	if cnf.JKT == "" {
+		if Scheme(r) == dpop.Scheme {
+			return fmt.Errorf("%w: token is not DPoP-bound", auth.ErrInvalidToken)
+		}
+
+		return nil
+	}
+
+	if Scheme(r) != dpop.Scheme {
+		return fmt.Errorf("%w: DPoP-bound token sent as a bearer token", auth.ErrInvalidToken)
+	}
+
+	proof, ok := dpop.FromContext(r.Context())
+	if !ok {
+		return fmt.Errorf("%w: DPoP proof is missing", auth.ErrInvalidToken)
+	}
+
+	if proof.JKT != cnf.JKT {
+		return fmt.Errorf("%w: token is bound to another DPoP key", auth.ErrInvalidToken)
+	}
+
+	if proof.ATH != dpop.AccessTokenHash(accessToken) {
+		return fmt.Errorf("%w: DPoP proof is for another token", auth.ErrInvalidToken)
+	}
+
+	return nil
+}
+
+type ProofVerifier interface {
+	Verify(ctx context.Context, proof string, method string, requestURL string) (dpop.Proof, error)
+}
+
+// DPoP verifies the DPoP proof of a request, if it has one, and puts it in
+// the request context. Its key becomes a confirmation too, so that tokens
+// issued while serving the request are bound to it. Requests with an invalid
+// proof are refused. baseURL is the URL clients reach the server at, such as
+// the issuer.
+func DPoP(v ProofVerifier, baseURL string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proofs := r.Header.Values(dpop.Header)
+			if len(proofs) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var (
+				proof dpop.Proof
+				err   = fmt.Errorf("%w: more than one proof", dpop.ErrInvalidProof)
+			)
+			if len(proofs) == 1 {
+				proof, err = v.Verify(r.Context(), proofs[0], r.Method, requestURL(r, baseURL))
+			}
+			if err != nil {
+				logger.SetError(r.Context(), err)
+				renderProofError(w, r)
+				return
+			}
+
+			cnf, _ := auth.ConfirmationFromContext(r.Context())
+			cnf.JKT = proof.JKT
+
+			ctx := dpop.NewContext(r.Context(), proof)
+			ctx = auth.NewConfirmationContext(ctx, cnf)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// renderProofError answers as the token endpoint does in RFC 9449 section
+// 5, or as a protected resource in section 7.1 when a token was sent.
+func renderProofError(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusBadRequest
+	if r.Header.Get("Authorization") != "" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP error="%s"`, oauth.ErrInvalidDPoPProof))
+		status = http.StatusUnauthorized
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(oauth.NewError(oauth.ErrInvalidDPoPProof, ""))
+}
+
+// requestURL is the URL a proof for r has to name in htu: the path of r under
+// baseURL. A proxy terminating TLS hides the scheme and maybe the host the
+// client used from r, so they only come from r without a baseURL.
+func requestURL(r *http.Request, baseURL string) string {
+	if baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/") + r.URL.Path
+	}
+
+	u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	return u.String()
+}
+
+// ClientCertificate returns the verified TLS client certificate of r, if any.
+func ClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return r.TLS.VerifiedChains[0][0]
+}
+
+type Decider interface {
+	Decide(in policy.Input) policy.Decision
+}
+
+// ResourceFunc returns the attributes of the resource a request acts on.
+type ResourceFunc func(r *http.Request) map[string]interface{}
+
+// RequirePolicy lets a request through only if d allows action for the
+// claims put in the context by Authenticate. resource may be nil.
+func RequirePolicy(d Decider, action string, resource ResourceFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			in := policy.Input{
+				Subject: policy.SubjectFromClaims(claims),
+				Action:  action,
+				Context: RequestContext(r),
+			}
+			if resource != nil {
+				in.Resource = resource(r)
+			}
+
+			if !d.Decide(in).Allowed {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestContext describes r for policy conditions as context.method,
+// context.path, context.ip and context.time in Unix seconds.
+func RequestContext(r *http.Request) map[string]interface{} {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"ip":     ip,
+		"time":   time.Now().Unix(),
+	}
+}
+
+// HasPermission reports whether granted contains permission, with the
+// wildcards of policy.Match.
+func HasPermission(granted []string, permission string) bool {
+	return policy.Match(granted, permission)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+
+	for _, prefix := range []string{"Bearer ", dpop.Scheme + " "} {
+		if len(h) > len(prefix) && strings.EqualFold(h[:len(prefix)], prefix) {
+			return h[len(prefix):], true
+		}
+	}
+
+	return "", false
+}
+
+// Scheme is the Authorization scheme of r, DPoP or Bearer.
+func Scheme(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > len(dpop.Scheme) && strings.EqualFold(h[:len(dpop.Scheme)+1], dpop.Scheme+" ") {
+		return dpop.Scheme
+	}
+
+	return "Bearer"
+}
@@ -0,0 +1,255 @@
+package authz
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/dpop"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/stretchr/testify/require"
+)
+
+type verifierFunc func(ctx context.Context, accessToken string) (*auth.CustomClaims, error)
+
+func (f verifierFunc) VerifyAccessToken(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+	return f(ctx, accessToken)
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		granted    []string
+		permission string
+		want       bool
+	}{
+		{granted: []string{"users:read"}, permission: "users:read", want: true},
+		{granted: []string{"users:read"}, permission: "users:write", want: false},
+		{granted: []string{"users:*"}, permission: "users:write", want: true},
+		{granted: []string{"users:*"}, permission: "usersx:write", want: false},
+		{granted: []string{"*"}, permission: "rbac:roles", want: true},
+		{granted: nil, permission: "users:read", want: false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, HasPermission(tt.granted, tt.permission), "%v %s", tt.granted, tt.permission)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier := verifierFunc(func(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+		switch accessToken {
+		case "admin":
+			return &auth.CustomClaims{Permissions: []string{"rbac:*"}}, nil
+		case "user":
+			return &auth.CustomClaims{}, nil
+		}
+		return nil, errors.New("invalid token")
+	})
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, found := ClaimsFromContext(r.Context())
+		require.True(t, found)
+	})
+	h := Authenticate(verifier)(RequirePermission("rbac:roles")(ok))
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{header: "", status: http.StatusUnauthorized},
+		{header: "Bearer bogus", status: http.StatusUnauthorized},
+		{header: "Bearer user", status: http.StatusForbidden},
+		{header: "Bearer admin", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin/roles", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.header)
+	}
+}
+
+func TestClientCertOrScope(t *testing.T) {
+	verifier := verifierFunc(func(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+		return &auth.CustomClaims{Scope: accessToken}, nil
+	})
+
+	tokenAuth := func(next http.Handler) http.Handler {
+		return Authenticate(verifier)(RequireScope("admin")(next))
+	}
+
+	operator := &x509.Certificate{Raw: []byte("operator"), Subject: pkix.Name{CommonName: "ops"}}
+	pinned := &x509.Certificate{Raw: []byte("pinned"), Subject: pkix.Name{CommonName: "pinned"}}
+	client := &x509.Certificate{Raw: []byte("client"), Subject: pkix.Name{CommonName: "billing"}}
+
+	allowed := []string{"ops", auth.CertificateThumbprint(pinned)}
+	h := ClientCertOr(allowed, tokenAuth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		header string
+		cert   *x509.Certificate
+		status int
+	}{
+		{name: "token without admin scope", header: "Bearer profile", status: http.StatusForbidden},
+		{name: "admin token", header: "Bearer profile admin", status: http.StatusOK},
+		{name: "admin by subject", cert: operator, status: http.StatusOK},
+		{name: "admin by thumbprint", cert: pinned, status: http.StatusOK},
+		{name: "client certificate", cert: client, status: http.StatusForbidden},
+		{name: "client certificate and token", cert: client, header: "Bearer profile", status: http.StatusForbidden},
+		{name: "client certificate and admin token", cert: client, header: "Bearer admin", status: http.StatusOK},
+		{name: "nothing", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin/config", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.cert != nil {
+			req = withCert(req, tt.cert)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.name)
+	}
+}
+
+func TestCertificateBinding(t *testing.T) {
+	issued := &x509.Certificate{Raw: []byte("issued")}
+	other := &x509.Certificate{Raw: []byte("other")}
+
+	// Tokens are issued within BindCertificate, which records the confirmation.
+	var cnf auth.Confirmation
+	BindCertificate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cnf, _ = auth.ConfirmationFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), withCert(httptest.NewRequest("POST", "/oauth/token", nil), issued))
+	require.Equal(t, auth.CertificateThumbprint(issued), cnf.X5tS256)
+
+	verifier := verifierFunc(func(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+		if accessToken == "bound" {
+			return &auth.CustomClaims{Cnf: &cnf}, nil
+		}
+		return &auth.CustomClaims{}, nil
+	})
+	h := Authenticate(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		token  string
+		cert   *x509.Certificate
+		status int
+	}{
+		{token: "bound", cert: issued, status: http.StatusOK},
+		{token: "bound", cert: other, status: http.StatusUnauthorized},
+		{token: "bound", status: http.StatusUnauthorized},
+		{token: "unbound", cert: other, status: http.StatusOK},
+		{token: "unbound", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.cert != nil {
+			req = withCert(req, tt.cert)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, "%s %v", tt.token, tt.cert != nil)
+	}
+}
+
+type proofVerifierFunc func(proof string) (dpop.Proof, error)
+
+func (f proofVerifierFunc) Verify(_ context.Context, proof string, _ string, _ string) (dpop.Proof, error) {
+	return f(proof)
+}
+
+func TestDPoPBinding(t *testing.T) {
+	// Proofs are "<jkt> <access token>" here; "bad" fails verification.
+	proofs := DPoP(proofVerifierFunc(func(proof string) (dpop.Proof, error) {
+		jkt, token, ok := strings.Cut(proof, " ")
+		if !ok {
+			return dpop.Proof{}, dpop.ErrInvalidProof
+		}
+		return dpop.Proof{JKT: jkt, ATH: dpop.AccessTokenHash(token)}, nil
+	}), "")
+
+	var cnf auth.Confirmation
+	proofs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cnf, _ = auth.ConfirmationFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), withProof(httptest.NewRequest("POST", "/auth", nil), "a "))
+	require.Equal(t, "a", cnf.JKT)
+
+	verifier := verifierFunc(func(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+		if accessToken == "bound" {
+			return &auth.CustomClaims{Cnf: &cnf}, nil
+		}
+		return &auth.CustomClaims{}, nil
+	})
+	h := proofs(Authenticate(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		scheme string
+		token  string
+		proof  string
+		status int
+	}{
+		{scheme: "DPoP", token: "bound", proof: "a bound", status: http.StatusOK},
+		{scheme: "DPoP", token: "bound", proof: "b bound", status: http.StatusUnauthorized},
+		{scheme: "DPoP", token: "bound", proof: "a other", status: http.StatusUnauthorized},
+		{scheme: "DPoP", token: "bound", status: http.StatusUnauthorized},
+		{scheme: "DPoP", token: "bound", proof: "bad", status: http.StatusUnauthorized},
+		{scheme: "Bearer", token: "bound", proof: "a bound", status: http.StatusUnauthorized},
+		{scheme: "DPoP", token: "unbound", proof: "a unbound", status: http.StatusUnauthorized},
+		{scheme: "Bearer", token: "unbound", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/userinfo", nil)
+		req.Header.Set("Authorization", tt.scheme+" "+tt.token)
+		if tt.proof != "" {
+			req = withProof(req, tt.proof)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, "%s %s %q", tt.scheme, tt.token, tt.proof)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, withProof(httptest.NewRequest("POST", "/auth", nil), "bad"))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), oauth.ErrInvalidDPoPProof)
+}
+
+func withProof(r *http.Request, proof string) *http.Request {
+	r.Header.Set(dpop.Header, proof)
+	return r
+}
+
+func withCert(r *http.Request, cert *x509.Certificate) *http.Request {
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+func TestRequestURL(t *testing.T) {
+	// Behind a proxy terminating TLS the request arrives over plain http.
+	r := httptest.NewRequest("POST", "http://10.0.0.5:8080/token?x=1", nil)
+
+	require.Equal(t, "https://auth.example.com/token", requestURL(r, "https://auth.example.com/"))
+	require.Equal(t, "http://10.0.0.5:8080/token", requestURL(r, ""))
+}
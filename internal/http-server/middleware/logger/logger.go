@@ -1,49 +1,92 @@
 package logger
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"time"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/recorder"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"golang.org/x/exp/slog"
 )
 
-type ResponseLogger struct {
-	w      http.ResponseWriter
-	status int
+type entryKey struct{}
+
+// entry collects what handlers further down learn about a request.
+type entry struct {
+	user   string
+	reason string
 }
 
-func NewResponseLogger(w http.ResponseWriter) *ResponseLogger {
-	return &ResponseLogger{
-		w:      w,
-		status: http.StatusOK,
+// SetUser records the user a request was made by or for.
+func SetUser(ctx context.Context, user string) {
+	if e, ok := ctx.Value(entryKey{}).(*entry); ok {
+		e.user = user
 	}
 }
 
-func (rl *ResponseLogger) Header() http.Header {
-	return rl.w.Header()
+// SetError records why a request failed, when the response body does not
+// say, as with a plain "Internal Server Error".
+func SetError(ctx context.Context, err error) {
+	if e, ok := ctx.Value(entryKey{}).(*entry); ok && err != nil {
+		e.reason = err.Error()
+	}
 }
 
-func (rl *ResponseLogger) Write(b []byte) (int, error) {
-	return rl.w.Write(b)
-}
+// New logs every request to log once it has been served: level Error for 5xx
+// responses, Warn for 4xx and Info otherwise. log is also put in the request
+// context for logctx.FromContext.
+func New(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e := &entry{}
+			rw := recorder.New(w)
+			start := time.Now()
 
-func (rl *ResponseLogger) WriteHeader(statusCode int) {
-	rl.status = statusCode
-}
+			ctx := context.WithValue(r.Context(), entryKey{}, e)
+			ctx = logctx.NewContext(ctx, log)
 
-func (rl *ResponseLogger) LogRequestInfo(method, path, remoteAddr, userAgent string, duration time.Duration) {
-	fmt.Printf("request completed - method: %s, path: %s, remote_addr: %s, user_agent: %s, duration: %s, status_code: %d\n",
-		method, path, remoteAddr, userAgent, duration.String(), rl.status)
-}
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			status := rw.Status()
 
-func Log(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rl := NewResponseLogger(w)
-		t1 := time.Now()
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+				slog.Int("status", status),
+				slog.Int("bytes", rw.Bytes()),
+				slog.Duration("duration", time.Since(start)),
+			}
 
-		defer func() {
-			rl.LogRequestInfo(r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent(), time.Since(t1))
-		}()
+			if id := logctx.RequestID(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+
+			if e.user != "" {
+				attrs = append(attrs, slog.String("user", e.user))
+			}
+
+			if reason := e.reason; reason != "" || status >= http.StatusBadRequest {
+				if reason == "" {
+					reason = rw.Body()
+				}
+				attrs = append(attrs, slog.String("error", reason))
+			}
+
+			log.LogAttrs(r.Context(), level(status), "request completed", attrs...)
+		})
+	}
+}
+
+func level(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	}
 
-		next.ServeHTTP(rl, r)
-	})
+	return slog.LevelInfo
 }
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := New(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), "alice")
+		SetError(r.Context(), errors.New("storage is down"))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/auth", nil))
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "ERROR", record["level"])
+	require.Equal(t, "/auth", record["path"])
+	require.EqualValues(t, http.StatusInternalServerError, record["status"])
+	require.EqualValues(t, rec.Body.Len(), record["bytes"])
+	require.Equal(t, "alice", record["user"])
+	require.Equal(t, "storage is down", record["error"])
+}
+
+func TestNewErrorBody(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := New(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Header 'Name' is missing", http.StatusBadRequest)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/auth", nil))
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "WARN", record["level"])
+	require.Equal(t, "Header 'Name' is missing", record["error"])
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+)
+
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+type Algorithm interface {
+	Take(state models.RateLimitState, rule Rule, now time.Time) (models.RateLimitState, Result)
+}
+
+func algorithmByName(name string) (Algorithm, error) {
+	const op = "http-server.middleware.ratelimit.algorithmByName"
+
+	switch name {
+	case TokenBucket, "":
+		return tokenBucket{}, nil
+	case SlidingWindow:
+		return slidingWindow{}, nil
+	}
+
+	return nil, fmt.Errorf("%s: unknown algorithm %q", op, name)
+}
+
+// tokenBucket refills Limit tokens per Window up to Burst and spends one token per request.
+type tokenBucket struct{}
+
+func (tokenBucket) Take(state models.RateLimitState, rule Rule, now time.Time) (models.RateLimitState, Result) {
+	capacity := float64(rule.capacity())
+	rate := float64(rule.Limit) / rule.Window.Seconds()
+
+	if state.Last.IsZero() {
+		state.Tokens = capacity
+	} else if elapsed := now.Sub(state.Last).Seconds(); elapsed > 0 {
+		state.Tokens = math.Min(capacity, state.Tokens+elapsed*rate)
+	}
+	state.Last = now
+
+	res := Result{Limit: rule.capacity()}
+
+	if state.Tokens >= 1 {
+		state.Tokens--
+		res.Allowed = true
+		res.Remaining = int(state.Tokens)
+		res.Reset = secondsToDuration((capacity - state.Tokens) / rate)
+	} else {
+		res.Reset = secondsToDuration((1 - state.Tokens) / rate)
+	}
+
+	return state, res
+}
+
+// slidingWindow approximates a rolling window by weighting the previous fixed
+// window's count with the part of it that still overlaps the rolling window.
+type slidingWindow struct{}
+
+func (slidingWindow) Take(state models.RateLimitState, rule Rule, now time.Time) (models.RateLimitState, Result) {
+	windowStart := now.Truncate(rule.Window)
+
+	switch {
+	case state.WindowStart.Equal(windowStart):
+	case state.WindowStart.Add(rule.Window).Equal(windowStart):
+		state.Prev, state.Curr = state.Curr, 0
+	default:
+		state.Prev, state.Curr = 0, 0
+	}
+	state.WindowStart = windowStart
+
+	elapsed := now.Sub(windowStart)
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	estimated := float64(state.Prev)*weight + float64(state.Curr)
+
+	res := Result{
+		Limit: rule.Limit,
+		Reset: rule.Window - elapsed,
+	}
+
+	if estimated+1 <= float64(rule.Limit) {
+		state.Curr++
+		res.Allowed = true
+		res.Remaining = int(float64(rule.Limit) - estimated - 1)
+	}
+
+	return state, res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+)
+
+const (
+	KeyByIP     = "ip"
+	KeyByUser   = "user"
+	KeyByClient = "client"
+)
+
+const maxRetries = 5
+
+var ErrContention = errors.New("too many concurrent updates")
+
+type KeyFunc func(r *http.Request) string
+
+type Rule struct {
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+	Burst     int
+	Key       KeyFunc
+}
+
+func (r Rule) capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	return r.Limit
+}
+
+type Limiter struct {
+	store Store
+	rules map[string]Rule
+	def   *Rule
+	now   func() time.Time
+}
+
+func New(cfg config.RateLimit, store Store) (*Limiter, error) {
+	const op = "http-server.middleware.ratelimit.New"
+
+	l := &Limiter{
+		store: store,
+		rules: make(map[string]Rule, len(cfg.Routes)),
+		now:   time.Now,
+	}
+
+	if cfg.Default.Limit > 0 {
+		rule, err := newRule(cfg.Default, config.RateLimitRule{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: default: %w", op, err)
+		}
+		l.def = &rule
+	}
+
+	for route, rc := range cfg.Routes {
+		rule, err := newRule(rc, cfg.Default)
+		if err != nil {
+			return nil, fmt.Errorf("%s: route %s: %w", op, route, err)
+		}
+		l.rules[route] = rule
+	}
+
+	return l, nil
+}
+
+func newRule(rc config.RateLimitRule, def config.RateLimitRule) (Rule, error) {
+	if rc.Algorithm == "" {
+		rc.Algorithm = def.Algorithm
+	}
+	if rc.KeyBy == "" {
+		rc.KeyBy = def.KeyBy
+	}
+	if rc.Window == 0 {
+		rc.Window = def.Window
+	}
+
+	if rc.Limit <= 0 {
+		return Rule{}, errors.New("limit must be positive")
+	}
+	if rc.Window <= 0 {
+		return Rule{}, errors.New("window must be positive")
+	}
+
+	algorithm, err := algorithmByName(rc.Algorithm)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	key, err := keyFuncByName(rc.KeyBy)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	return Rule{
+		Algorithm: algorithm,
+		Limit:     rc.Limit,
+		Window:    rc.Window,
+		Burst:     rc.Burst,
+		Key:       key,
+	}, nil
+}
+
+func (l *Limiter) rule(route string) (Rule, bool) {
+	if rule, ok := l.rules[route]; ok {
+		return rule, true
+	}
+
+	if l.def != nil {
+		return *l.def, true
+	}
+
+	return Rule{}, false
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	const op = "http-server.middleware.ratelimit.Allow"
+
+	for i := 0; i < maxRetries; i++ {
+		state, version, err := l.store.Get(ctx, key)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		state, res := rule.Algorithm.Take(state, rule, l.now())
+
+		ok, err := l.store.CompareAndSwap(ctx, key, version, state, rule.Window*2)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if ok {
+			return res, nil
+		}
+	}
+
+	return Result{}, fmt.Errorf("%s: %w", op, ErrContention)
+}
+
+// Middleware limits requests to route. Requests are let through when the store
+// is unavailable so that a broken limiter never takes the service down.
+func (l *Limiter) Middleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		rule, ok := l.rule(route)
+		if !ok {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := route + ":" + rule.Key(r)
+
+			res, err := l.Allow(r.Context(), key, rule)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setHeaders(w, rule, res)
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", seconds(res.Reset))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setHeaders(w http.ResponseWriter, rule Rule, res Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", rule.Limit, seconds(rule.Window)))
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func keyFuncByName(name string) (KeyFunc, error) {
+	switch name {
+	case KeyByIP, "":
+		return keyByIP, nil
+	case KeyByUser:
+		return keyByUser, nil
+	case KeyByClient:
+		return keyByClient, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", name)
+}
+
+func keyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+func keyByUser(r *http.Request) string {
+	if user := r.Header.Get("Name"); user != "" {
+		return "user:" + user
+	}
+
+	return keyByIP(r)
+}
+
+func keyByClient(r *http.Request) string {
+	if clientID, _, ok := r.BasicAuth(); ok && clientID != "" {
+		return "client:" + clientID
+	}
+
+	if clientID := r.FormValue("client_id"); clientID != "" {
+		return "client:" + clientID
+	}
+
+	return keyByIP(r)
+}
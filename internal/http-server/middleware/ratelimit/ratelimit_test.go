@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	rule := Rule{Limit: 2, Window: time.Second, Burst: 2}
+	now := time.Now()
+
+	var state models.RateLimitState
+	var res Result
+
+	state, res = tokenBucket{}.Take(state, rule, now)
+	require.True(t, res.Allowed)
+	require.Equal(t, 1, res.Remaining)
+
+	state, res = tokenBucket{}.Take(state, rule, now)
+	require.True(t, res.Allowed)
+
+	state, res = tokenBucket{}.Take(state, rule, now)
+	require.False(t, res.Allowed)
+	require.Equal(t, 500*time.Millisecond, res.Reset)
+
+	_, res = tokenBucket{}.Take(state, rule, now.Add(500*time.Millisecond))
+	require.True(t, res.Allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rule := Rule{Limit: 2, Window: time.Minute}
+	start := time.Now().Truncate(time.Minute)
+
+	var state models.RateLimitState
+	var res Result
+
+	state, _ = slidingWindow{}.Take(state, rule, start)
+	state, _ = slidingWindow{}.Take(state, rule, start.Add(time.Second))
+
+	state, res = slidingWindow{}.Take(state, rule, start.Add(2*time.Second))
+	require.False(t, res.Allowed)
+
+	// Half of the previous window still counts: 2*0.5 = 1 request left.
+	state, res = slidingWindow{}.Take(state, rule, start.Add(90*time.Second))
+	require.True(t, res.Allowed)
+
+	_, res = slidingWindow{}.Take(state, rule, start.Add(91*time.Second))
+	require.False(t, res.Allowed)
+}
+
+func TestMemoryStoreCompareAndSwap(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	_, version, err := s.Get(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), version)
+
+	ok, err := s.CompareAndSwap(ctx, "key", version, models.RateLimitState{Curr: 1}, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = s.CompareAndSwap(ctx, "key", version, models.RateLimitState{Curr: 2}, time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	state, version, err := s.Get(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), version)
+	require.Equal(t, int64(1), state.Curr)
+}
+
+func TestMiddleware(t *testing.T) {
+	l, err := New(config.RateLimit{
+		Routes: map[string]config.RateLimitRule{
+			"/auth": {Algorithm: TokenBucket, KeyBy: KeyByUser, Limit: 1, Window: time.Minute},
+		},
+	}, NewMemoryStore())
+	require.NoError(t, err)
+
+	h := l.Middleware("/auth")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/auth", nil)
+	req.Header.Set("Name", "user")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	req.Header.Set("Name", "other")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestNewUnknownAlgorithm(t *testing.T) {
+	_, err := New(config.RateLimit{
+		Default: config.RateLimitRule{Algorithm: "leaky", Limit: 1, Window: time.Second},
+	}, NewMemoryStore())
+	require.Error(t, err)
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+)
+
+// Store keeps limiter state. Implementations shared between nodes must make
+// CompareAndSwap atomic: it succeeds only if the stored version still equals version.
+type Store interface {
+	Get(ctx context.Context, key string) (models.RateLimitState, int64, error)
+	CompareAndSwap(ctx context.Context, key string, version int64, state models.RateLimitState, ttl time.Duration) (bool, error)
+}
+
+type memoryEntry struct {
+	state     models.RateLimitState
+	version   int64
+	expiresAt time.Time
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (models.RateLimitState, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return models.RateLimitState{}, 0, nil
+	}
+
+	if s.now().After(e.expiresAt) {
+		return models.RateLimitState{}, e.version, nil
+	}
+
+	return e.state, e.version, nil
+}
+
+func (s *MemoryStore) CompareAndSwap(_ context.Context, key string, version int64, state models.RateLimitState, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if s.entries[key].version != version {
+		return false, nil
+	}
+
+	s.entries[key] = memoryEntry{
+		state:     state,
+		version:   version + 1,
+		expiresAt: now.Add(ttl),
+	}
+
+	return true, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	const sweepInterval = time.Minute
+
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if now.After(e.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package requestid
+
+import (
+	"net/http"
+
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/google/uuid"
+)
+
+const (
+	Header = "X-Request-ID"
+
+	maxLength = 128
+)
+
+// Middleware puts the request ID in the request context and echoes it in the
+// response. A valid X-Request-ID from the client is kept, so calls can be
+// correlated across services; otherwise a new one is generated.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(Header, id)
+
+		next.ServeHTTP(w, r.WithContext(logctx.WithRequestID(r.Context(), id)))
+	})
+}
+
+// valid accepts short IDs of printable ASCII, which are safe to log and echo.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logctx.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{header: "abc-123", keep: true},
+		{header: "", keep: false},
+		{header: "has space", keep: false},
+		{header: strings.Repeat("a", maxLength+1), keep: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/auth", nil)
+		if tt.header != "" {
+			req.Header.Set(Header, tt.header)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		require.NotEmpty(t, seen)
+		require.Equal(t, seen, rec.Header().Get(Header))
+		require.Equal(t, tt.keep, seen == tt.header, tt.header)
+	}
+}
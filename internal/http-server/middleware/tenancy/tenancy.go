@@ -0,0 +1,29 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ZiganshinDev/medods/internal/tenant"
+)
+
+// New resolves the tenant of each request from the tenant header or the host
+// and puts it in the request context. Requests without a known tenant are
+// rejected before they reach next.
+func New(registry *tenant.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := registry.Resolve(r.Header.Get(registry.Header()), r.Host)
+			if errors.Is(err, tenant.ErrUnknownTenant) {
+				http.Error(w, "Unknown tenant", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Tenant is not specified", http.StatusBadRequest)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), t)))
+		})
+	}
+}
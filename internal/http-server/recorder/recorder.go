@@ -0,0 +1,101 @@
+// Package recorder wraps an http.ResponseWriter to learn what was written
+// to it, for middleware that logs or measures responses.
+package recorder
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// maxBody is how much of the body of an error response is kept.
+const maxBody = 128
+
+// Recorder records the status and size of a response, and the start of its
+// body for error responses. It passes Flush and Hijack through, and Unwrap
+// lets http.ResponseController reach the underlying writer.
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	body   []byte
+}
+
+func New(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// Status returns the status of the response, 200 if none was written.
+func (r *Recorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+// Bytes returns the size of the body written so far.
+func (r *Recorder) Bytes() int {
+	return r.bytes
+}
+
+// Body returns the start of the body of an error response, without a
+// trailing newline.
+func (r *Recorder) Body() string {
+	return string(trimNewline(r.body))
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	if r.status >= http.StatusBadRequest && len(r.body) < maxBody {
+		rest := maxBody - len(r.body)
+		if rest > len(b) {
+			rest = len(b)
+		}
+		r.body = append(r.body, b[:rest]...)
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+func (r *Recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	return h.Hijack()
+}
+
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func trimNewline(b []byte) []byte {
+	if n := len(b); n > 0 && b[n-1] == '\n' {
+		return b[:n-1]
+	}
+
+	return b
+}
@@ -0,0 +1,34 @@
+package recorder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	r := New(httptest.NewRecorder())
+	require.Equal(t, http.StatusOK, r.Status())
+
+	http.Error(r, "Header 'Name' is missing", http.StatusBadRequest)
+	r.WriteHeader(http.StatusInternalServerError)
+
+	require.Equal(t, http.StatusBadRequest, r.Status())
+	require.Equal(t, "Header 'Name' is missing", r.Body())
+	require.Equal(t, len("Header 'Name' is missing\n"), r.Bytes())
+}
+
+func TestRecorderFlusher(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	var w http.ResponseWriter = New(rec)
+	f, ok := w.(http.Flusher)
+	require.True(t, ok)
+
+	f.Flush()
+	require.True(t, rec.Flushed)
+
+	require.Equal(t, rec, http.ResponseWriter(New(rec)).(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+}
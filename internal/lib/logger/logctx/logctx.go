@@ -0,0 +1,44 @@
+// Package logctx carries the request ID and logger in a context, so that
+// records logged anywhere down the stack can be correlated.
+package logctx
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+type (
+	requestIDKey struct{}
+	loggerKey    struct{}
+)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewContext stores log in ctx for FromContext.
+func NewContext(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// FromContext returns the logger stored in ctx, or slog.Default, with the
+// request ID of ctx attached.
+func FromContext(ctx context.Context) *slog.Logger {
+	log, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		log = slog.Default()
+	}
+
+	if id := RequestID(ctx); id != "" {
+		log = log.With(slog.String("request_id", id))
+	}
+
+	return log
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/http-server/recorder"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+// Token kinds used as the "type" label.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+	TokenID      = "id"
+	TokenSession = "session"
+)
+
+// Metrics holds the Prometheus collectors of the service. All methods are
+// safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	tokensIssued       *prometheus.CounterVec
+	refreshes          *prometheus.CounterVec
+	validationFailures *prometheus.CounterVec
+	revocations        *prometheus.CounterVec
+	handlerDuration    *prometheus.HistogramVec
+	hashDuration       *prometheus.HistogramVec
+	storageDuration    *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Tokens issued, by type.",
+		}, []string{"type"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refreshes_total",
+			Help:      "Refresh token exchanges, by outcome.",
+		}, []string{"outcome"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validation_failures_total",
+			Help:      "Tokens that failed validation, by reason.",
+		}, []string{"reason"}),
+		revocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revocations_total",
+			Help:      "Revoked tokens and sessions, by type.",
+		}, []string{"type"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		hashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bcrypt_duration_seconds",
+			Help:      "Time spent hashing and comparing refresh tokens with bcrypt.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+		}, []string{"op"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_duration_seconds",
+			Help:      "Latency of storage operations, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+		}, []string{"op"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.tokensIssued,
+		m.refreshes,
+		m.validationFailures,
+		m.revocations,
+		m.handlerDuration,
+		m.hashDuration,
+		m.storageDuration,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) TokenIssued(kind string) {
+	if m == nil {
+		return
+	}
+
+	m.tokensIssued.WithLabelValues(kind).Inc()
+}
+
+func (m *Metrics) Refreshed(ok bool) {
+	if m == nil {
+		return
+	}
+
+	m.refreshes.WithLabelValues(outcome(ok)).Inc()
+}
+
+func (m *Metrics) ValidationFailed(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.validationFailures.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) Revoked(kind string) {
+	if m == nil {
+		return
+	}
+
+	m.revocations.WithLabelValues(kind).Inc()
+}
+
+// ObserveHash records a bcrypt operation that began at start.
+func (m *Metrics) ObserveHash(op string, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.hashDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// ObserveStorage records a storage operation that began at start.
+func (m *Metrics) ObserveStorage(op string, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.storageDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// Middleware records the latency of the requests to route.
+func (m *Metrics) Middleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if m == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := recorder.New(w)
+
+			next.ServeHTTP(rec, r)
+
+			m.handlerDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status())).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+func outcome(ok bool) string {
+	if ok {
+		return "success"
+	}
+
+	return "failure"
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	m.TokenIssued(TokenAccess)
+	m.ValidationFailed("invalid")
+	m.ObserveStorage("op", time.Now())
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	require.NotNil(t, m.Middleware("/auth")(next))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+
+	m.TokenIssued(TokenAccess)
+	m.Refreshed(false)
+	m.ValidationFailed("revoked")
+
+	h := m.Middleware("/auth")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/auth", nil))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	require.Contains(t, body, `auth_tokens_issued_total{type="access"} 1`)
+	require.Contains(t, body, `auth_refreshes_total{outcome="failure"} 1`)
+	require.Contains(t, body, `auth_token_validation_failures_total{reason="revoked"} 1`)
+	require.Contains(t, body, `auth_http_request_duration_seconds_count{code="418",method="GET",route="/auth"} 1`)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEvent is one entry of the security audit trail. Entries are only ever
+// appended.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Time      time.Time          `json:"time" bson:"time"`
+	Type      string             `json:"type" bson:"type"`
+	Outcome   string             `json:"outcome" bson:"outcome"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Actor     string             `json:"actor,omitempty" bson:"actor,omitempty"`
+	Subject   string             `json:"subject,omitempty" bson:"subject,omitempty"`
+	TenantID  string             `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	SessionID string             `json:"session_id,omitempty" bson:"session_id,omitempty"`
+	ClientID  string             `json:"client_id,omitempty" bson:"client_id,omitempty"`
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestID string             `json:"request_id,omitempty" bson:"request_id,omitempty"`
+}
+
+// AuditFilter selects audit events of a subject within [From, To). Zero
+// values do not filter.
+type AuditFilter struct {
+	Subject string
+	From    time.Time
+	To      time.Time
+	Limit   int64
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// SigningKey is an ID token signing key created by a key rotation. The
+// private key is encrypted, see auth.EncryptPrivateKey.
+type SigningKey struct {
+	ID           string    `bson:"_id"`
+	EncryptedKey []byte    `bson:"encrypted_key"`
+	CreatedTime  time.Time `bson:"created_time"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type Client struct {
+	ID           string    `bson:"_id"`
+	Name         string    `bson:"name"`
+	SecretHash   string    `bson:"secret_hash,omitempty"`
+	RedirectURIs []string  `bson:"redirect_uris"`
+	Scopes       []string  `bson:"scopes"`
+	GrantTypes   []string  `bson:"grant_types"`
+	TLSSubject   string    `bson:"tls_subject,omitempty"`
+	CreatedTime  time.Time `bson:"created_time"`
+
+	TokenExchange TokenExchangePolicy `bson:"token_exchange"`
+}
+
+// TokenExchangePolicy limits what a client may do with the token exchange grant.
+type TokenExchangePolicy struct {
+	Audiences     []string `bson:"audiences"`
+	Delegation    bool     `bson:"delegation"`
+	Impersonation bool     `bson:"impersonation"`
+}
+
+// Confidential clients authenticate with a secret or a TLS client
+// certificate.
+func (c Client) Confidential() bool {
+	return c.SecretHash != "" || c.TLSSubject != ""
+}
+
+type AuthorizationCode struct {
+	CodeHash            string    `bson:"_id"`
+	ClientID            string    `bson:"client_id"`
+	UserName            string    `bson:"user_name"`
+	RedirectURI         string    `bson:"redirect_uri"`
+	Scope               string    `bson:"scope"`
+	CodeChallenge       string    `bson:"code_challenge"`
+	CodeChallengeMethod string    `bson:"code_challenge_method"`
+	Nonce               string    `bson:"nonce,omitempty"`
+	AuthTime            time.Time `bson:"auth_time"`
+	TenantID            string    `bson:"tenant_id,omitempty"`
+	ExpiresAt           time.Time `bson:"expires_at"`
+	CreatedTime         time.Time `bson:"created_time"`
+}
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+type DeviceCode struct {
+	DeviceCodeHash string    `bson:"_id"`
+	UserCode       string    `bson:"user_code"`
+	ClientID       string    `bson:"client_id"`
+	Scope          string    `bson:"scope"`
+	Status         string    `bson:"status"`
+	UserName       string    `bson:"user_name,omitempty"`
+	AuthTime       time.Time `bson:"auth_time,omitempty"`
+	TenantID       string    `bson:"tenant_id,omitempty"`
+	Interval       int64     `bson:"interval"`
+	LastPolledAt   time.Time `bson:"last_polled_at"`
+	ExpiresAt      time.Time `bson:"expires_at"`
+	CreatedTime    time.Time `bson:"created_time"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type RateLimitState struct {
+	Tokens      float64   `bson:"tokens"`
+	Last        time.Time `bson:"last"`
+	WindowStart time.Time `bson:"window_start"`
+	Prev        int64     `bson:"prev"`
+	Curr        int64     `bson:"curr"`
+}
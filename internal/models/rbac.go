@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role is a named set of permissions within a tenant. Tenants can have roles
+// of the same name.
+type Role struct {
+	Name        string    `bson:"name" json:"name"`
+	TenantID    string    `bson:"tenant_id,omitempty" json:"-"`
+	Permissions []string  `bson:"permissions" json:"permissions"`
+	UpdatedTime time.Time `bson:"updated_time" json:"updated_time"`
+}
+
+// UserRoles are the roles of a user within a tenant.
+type UserRoles struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserName string             `bson:"user_name" json:"user_name"`
+	TenantID string             `bson:"tenant_id,omitempty" json:"-"`
+	Roles    []string           `bson:"roles" json:"roles"`
+}
@@ -10,5 +10,32 @@ type Users struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name         string             `bson:"name"`
 	RefreshToken string             `bson:"refresh_token"`
+	TokenID      string             `bson:"token_id"`
+	ClientID     string             `bson:"client_id,omitempty"`
+	Scope        string             `bson:"scope,omitempty"`
+	TenantID     string             `bson:"tenant_id,omitempty"`
+	JKT          string             `bson:"jkt,omitempty"`
+	AuthTime     time.Time          `bson:"auth_time"`
 	CreatedTime  time.Time          `bson:"created_time"`
 }
+
+// RotatedToken records a refresh token that has been replaced by a newer one,
+// so that presenting it again can be told apart from an unknown token.
+type RotatedToken struct {
+	TokenID   string    `bson:"_id"`
+	Name      string    `bson:"name"`
+	TenantID  string    `bson:"tenant_id,omitempty"`
+	ClientID  string    `bson:"client_id,omitempty"`
+	SessionID string    `bson:"session_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// UserLock keeps a user from signing in until it is removed.
+type UserLock struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	UserName string             `bson:"user_name"`
+	TenantID string             `bson:"tenant_id,omitempty"`
+	Reason   string             `bson:"reason,omitempty"`
+	LockedBy string             `bson:"locked_by"`
+	LockedAt time.Time          `bson:"locked_at"`
+}
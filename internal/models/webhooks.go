@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery tracks one event sent to one endpoint, across its attempts.
+// Deliveries that run out of attempts are also kept in the dead-letter store.
+// A pending delivery is worked on by its Owner until LeaseUntil. RequestID is
+// the request the event was published in, if any.
+type WebhookDelivery struct {
+	ID             string    `json:"id" bson:"_id"`
+	EventID        string    `json:"event_id" bson:"event_id"`
+	EventType      string    `json:"event_type" bson:"event_type"`
+	URL            string    `json:"url" bson:"url"`
+	Payload        string    `json:"payload" bson:"payload"`
+	RequestID      string    `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Status         string    `json:"status" bson:"status"`
+	Attempts       int       `json:"attempts" bson:"attempts"`
+	LastStatusCode int       `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt  time.Time `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	Owner          string    `json:"owner,omitempty" bson:"owner,omitempty"`
+	LeaseUntil     time.Time `json:"lease_until,omitempty" bson:"lease_until,omitempty"`
+	CreatedTime    time.Time `json:"created_time" bson:"created_time"`
+	UpdatedTime    time.Time `json:"updated_time" bson:"updated_time"`
+}
@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// userCodeAlphabet has no vowels and no easily confused characters, as RFC 8628 section 6.1 suggests.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type DeviceVerification struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+// NewUserCode returns a code in the XXXX-XXXX form users type on a second device.
+func NewUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+
+	var b strings.Builder
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			b.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// NormalizeUserCode accepts what a user typed, in any case and with or without separators.
+func NormalizeUserCode(userCode string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, c) {
+			b.WriteRune(c)
+		}
+	}
+
+	code := b.String()
+	if len(code) != userCodeLength {
+		return code
+	}
+
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
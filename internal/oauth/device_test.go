@@ -0,0 +1,21 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUserCode(t *testing.T) {
+	code, err := NewUserCode()
+	require.NoError(t, err)
+	require.Len(t, code, userCodeLength+1)
+	require.Equal(t, byte('-'), code[userCodeLength/2])
+	require.Equal(t, code, NormalizeUserCode(code))
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	require.Equal(t, "WDJB-MJHT", NormalizeUserCode("wdjb mjht"))
+	require.Equal(t, "WDJB-MJHT", NormalizeUserCode("WDJBMJHT"))
+	require.Equal(t, "WDJ", NormalizeUserCode("wdj"))
+}
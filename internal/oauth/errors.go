@@ -0,0 +1,74 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error codes from RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrInvalidScope            = "invalid_scope"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+
+	// RFC 8628 section 3.5.
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrExpiredToken         = "expired_token"
+
+	// RFC 8693 section 2.2.2.
+	ErrInvalidTarget = "invalid_target"
+
+	// RFC 6750 section 3.1.
+	ErrInvalidToken      = "invalid_token"
+	ErrInsufficientScope = "insufficient_scope"
+
+	// RFC 9449 section 12.2.
+	ErrInvalidDPoPProof = "invalid_dpop_proof"
+)
+
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func NewError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+func (e *Error) Status() int {
+	switch e.Code {
+	case ErrInvalidClient, ErrInvalidToken:
+		return http.StatusUnauthorized
+	case ErrInsufficientScope:
+		return http.StatusForbidden
+	case ErrServerError:
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusBadRequest
+}
+
+// AsError returns err as an OAuth error, turning anything unexpected into server_error.
+func AsError(err error) *Error {
+	var oerr *Error
+	if errors.As(err, &oerr) {
+		return oerr
+	}
+
+	return NewError(ErrServerError, "")
+}
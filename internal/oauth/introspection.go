@@ -0,0 +1,25 @@
+package oauth
+
+import "github.com/ZiganshinDev/medods/internal/auth"
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// IntrospectionResponse is the RFC 7662 section 2.2 response. Inactive tokens
+// carry only the active member.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+
+	// Cnf is the confirmation of a sender-constrained access token.
+	Cnf *auth.Confirmation `json:"cnf,omitempty"`
+	// ImpersonatedBy is set on tokens a client obtained by impersonation.
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+}
@@ -0,0 +1,82 @@
+package oauth
+
+import "crypto/x509"
+
+const (
+	ResponseTypeCode = "code"
+
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// Token type identifiers from RFC 8693 section 3.
+const (
+	TokenTypeIDAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Client authentication methods from RFC 6749 section 2.3.1.
+const (
+	AuthMethodNone  = "none"
+	AuthMethodBasic = "client_secret_basic"
+	AuthMethodPost  = "client_secret_post"
+
+	// AuthMethodTLSClient is PKI mutual TLS client authentication from
+	// RFC 8705 section 2.1.
+	AuthMethodTLSClient = "tls_client_auth"
+)
+
+type ClientCredentials struct {
+	ID     string
+	Secret string
+	Method string
+	// Certificate is the verified TLS client certificate of the connection,
+	// set with AuthMethodTLSClient.
+	Certificate *x509.Certificate
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Client       ClientCredentials
+	Scope        string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	DeviceCode   string
+	RefreshToken string
+
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	Audience           string
+	RequestedTokenType string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
@@ -0,0 +1,34 @@
+package oauth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test vector from RFC 7636 appendix B.
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestS256Challenge(t *testing.T) {
+	require.Equal(t, testChallenge, S256Challenge(testVerifier))
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	require.True(t, VerifyPKCE(testVerifier, testChallenge, ChallengeS256))
+}
+
+func TestVerifyPKCEError(t *testing.T) {
+	require.False(t, VerifyPKCE(testVerifier, testChallenge, "plain"))
+	require.False(t, VerifyPKCE(testVerifier+"x", testChallenge, ChallengeS256))
+	require.False(t, VerifyPKCE("short", S256Challenge("short"), ChallengeS256))
+}
+
+func TestValidVerifier(t *testing.T) {
+	require.True(t, ValidVerifier(strings.Repeat("a", 43)))
+	require.False(t, ValidVerifier(strings.Repeat("a", 129)))
+	require.False(t, ValidVerifier(strings.Repeat("a", 42)+"!"))
+}
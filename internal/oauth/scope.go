@@ -0,0 +1,37 @@
+package oauth
+
+import "strings"
+
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// ContainsAll reports whether every scope in requested is in allowed.
+func ContainsAll(allowed, requested []string) bool {
+	set := make(map[string]struct{}, len(allowed))
+	for _, s := range allowed {
+		set[s] = struct{}{}
+	}
+
+	for _, s := range requested {
+		if _, ok := set[s]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func HasScope(scope string, want string) bool {
+	for _, s := range ParseScope(scope) {
+		if s == want {
+			return true
+		}
+	}
+
+	return false
+}
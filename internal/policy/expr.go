@@ -0,0 +1,477 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrType = errors.New("type mismatch")
+
+// Expr is a compiled condition. The language has string, number, boolean and
+// null literals, lists in brackets, dotted attribute paths such as
+// subject.roles, the comparisons == != < <= > >=, membership with "in", and
+// the boolean operators ! && || with parentheses for grouping.
+type Expr struct {
+	src  string
+	root node
+}
+
+func Compile(src string) (*Expr, error) {
+	const op = "policy.Compile"
+
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("%s: position %d: unexpected %q", op, t.pos, t.text)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against attrs. Attribute paths that do not
+// exist evaluate to null. The result must be a boolean.
+func (e *Expr) Eval(attrs map[string]interface{}) (bool, error) {
+	v, err := e.root.eval(normalize(attrs).(map[string]interface{}))
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: condition is %s, not a boolean", ErrType, typeName(v))
+	}
+
+	return b, nil
+}
+
+type node interface {
+	eval(attrs map[string]interface{}) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type path []string
+
+func (n path) eval(attrs map[string]interface{}) (interface{}, error) {
+	var v interface{} = attrs
+
+	for _, name := range n {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		v = m[name]
+	}
+
+	return v, nil
+}
+
+type list []node
+
+func (n list) eval(attrs map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n))
+	for _, item := range n {
+		v, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+type not struct {
+	operand node
+}
+
+func (n not) eval(attrs map[string]interface{}) (interface{}, error) {
+	v, err := evalBool(n.operand, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return !v, nil
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n logical) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(n.left, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return left, nil
+	}
+
+	return evalBool(n.right, attrs)
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n comparison) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := n.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		return contains(left, right)
+	}
+
+	return compare(n.op, left, right)
+}
+
+func evalBool(n node, attrs map[string]interface{}) (bool, error) {
+	v, err := n.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s is not a boolean", ErrType, typeName(v))
+	}
+
+	return b, nil
+}
+
+// contains reports whether item is an element of a list or a key of an object.
+func contains(item interface{}, collection interface{}) (bool, error) {
+	switch c := collection.(type) {
+	case []interface{}:
+		for _, v := range c {
+			if reflect.DeepEqual(item, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: object key is %s, not a string", ErrType, typeName(item))
+		}
+		_, found := c[key]
+		return found, nil
+	case nil:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%w: cannot use in with %s", ErrType, typeName(collection))
+}
+
+func compare(op string, left interface{}, right interface{}) (bool, error) {
+	var cmp int
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("%w: cannot compare number with %s", ErrType, typeName(right))
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: cannot compare string with %s", ErrType, typeName(right))
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return false, fmt.Errorf("%w: cannot order %s", ErrType, typeName(left))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// normalize converts Go values to the types the evaluator works with: numbers
+// become float64, slices []interface{} and string maps map[string]interface{}.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, bool, float64, string:
+		return t
+	case int:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case []string:
+		values := make([]interface{}, 0, len(t))
+		for _, s := range t {
+			values = append(values, s)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, 0, len(t))
+		for _, item := range t {
+			values = append(values, normalize(item))
+		}
+		return values
+	case map[string]string:
+		m := make(map[string]interface{}, len(t))
+		for k, s := range t {
+			m[k] = s
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			m[k] = normalize(item)
+		}
+		return m
+	}
+
+	return fmt.Sprint(v)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOp && !(t.kind == tokenIdent && t.text == "in") {
+		return false
+	}
+
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "in") {
+		return left, nil
+	}
+
+	op := p.next().text
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return literal{value: t.value}, nil
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("position %d: expected ) but found %q", t.pos, t.text)
+		}
+		return n, nil
+	case tokenLBracket:
+		return p.parseList()
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literal{value: true}, nil
+		case "false":
+			return literal{value: false}, nil
+		case "null":
+			return literal{value: nil}, nil
+		case "in":
+			return nil, fmt.Errorf("position %d: unexpected in", t.pos)
+		}
+		return p.parsePath(t.text)
+	case tokenEOF:
+		return nil, fmt.Errorf("position %d: unexpected end of expression", t.pos)
+	}
+
+	return nil, fmt.Errorf("position %d: unexpected %q", t.pos, t.text)
+}
+
+func (p *parser) parseList() (node, error) {
+	items := list{}
+
+	if p.peek().kind == tokenRBracket {
+		p.next()
+		return items, nil
+	}
+
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		t := p.next()
+		if t.kind == tokenRBracket {
+			return items, nil
+		}
+		if t.kind != tokenComma {
+			return nil, fmt.Errorf("position %d: expected , or ] but found %q", t.pos, t.text)
+		}
+	}
+}
+
+func (p *parser) parsePath(first string) (node, error) {
+	n := path{first}
+
+	for p.peek().kind == tokenDot {
+		p.next()
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, fmt.Errorf("position %d: expected attribute name after .", t.pos)
+		}
+		n = append(n, t.text)
+	}
+
+	return n, nil
+}
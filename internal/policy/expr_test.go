@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	attrs := map[string]interface{}{
+		"subject": map[string]interface{}{
+			"sub":    "alice",
+			"roles":  []string{"support"},
+			"tenant": "acme",
+			"level":  3,
+		},
+		"resource": map[string]interface{}{
+			"tenant":    "acme",
+			"owner":     "bob",
+			"labels":    map[string]string{"pii": "true"},
+			"max_level": 5,
+		},
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: `true`, want: true},
+		{src: `"support" in subject.roles`, want: true},
+		{src: `"admin" in subject.roles`, want: false},
+		{src: `subject.tenant == resource.tenant`, want: true},
+		{src: `subject.sub != resource.owner && subject.level < resource.max_level`, want: true},
+		{src: `subject.level >= 3.5 || subject.sub == 'alice'`, want: true},
+		{src: `!(subject.tenant == "other")`, want: true},
+		{src: `"pii" in resource.labels`, want: true},
+		{src: `subject.missing == null`, want: true},
+		{src: `subject.sub in ["alice", "bob"]`, want: true},
+		{src: `"x" in subject.missing`, want: false},
+		{src: `subject.sub == "al\"ice"`, want: false},
+		{src: `subject.level > -1`, want: true},
+	}
+
+	for _, tt := range tests {
+		expr, err := Compile(tt.src)
+		require.NoError(t, err, tt.src)
+
+		got, err := expr.Eval(attrs)
+		require.NoError(t, err, tt.src)
+		require.Equal(t, tt.want, got, tt.src)
+	}
+}
+
+func TestEvalTypeError(t *testing.T) {
+	for _, src := range []string{
+		`subject.sub`,
+		`subject.sub && true`,
+		`subject.sub < 3`,
+		`"x" in subject.sub`,
+	} {
+		expr, err := Compile(src)
+		require.NoError(t, err, src)
+
+		_, err = expr.Eval(map[string]interface{}{"subject": map[string]interface{}{"sub": "alice"}})
+		require.True(t, errors.Is(err, ErrType), src)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`subject.`,
+		`(true`,
+		`"unterminated`,
+		`a == == b`,
+		`[1, 2`,
+		`a # b`,
+		`true false`,
+	} {
+		_, err := Compile(src)
+		require.Error(t, err, src)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// The right operand would fail with a type error if it were evaluated.
+	expr, err := Compile(`false && subject.sub < 1`)
+	require.NoError(t, err)
+
+	got, err := expr.Eval(map[string]interface{}{"subject": map[string]interface{}{"sub": "alice"}})
+	require.NoError(t, err)
+	require.False(t, got)
+}
@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Input is what a decision is made about. Conditions see it as the attributes
+// subject, action, resource and context.
+type Input struct {
+	Subject  map[string]interface{} `json:"subject"`
+	Action   string                 `json:"action"`
+	Resource map[string]interface{} `json:"resource,omitempty"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type Rule struct {
+	Name      string
+	Effect    string
+	Actions   []string
+	Condition *Expr
+}
+
+// Engine evaluates rules with deny overrides: a matching deny rule wins over
+// any allow rule, and a request no rule allows is denied.
+type Engine struct {
+	rules []Rule
+}
+
+func New(rules []Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// NewFromConfig compiles the rule conditions from the config.
+func NewFromConfig(cfg config.Policy) (*Engine, error) {
+	const op = "policy.NewFromConfig"
+
+	rules := make([]Rule, 0, len(cfg.Rules))
+
+	for _, rc := range cfg.Rules {
+		if rc.Effect != EffectAllow && rc.Effect != EffectDeny {
+			return nil, fmt.Errorf("%s: rule %s: unknown effect %q", op, rc.Name, rc.Effect)
+		}
+
+		if len(rc.Actions) == 0 {
+			return nil, fmt.Errorf("%s: rule %s: %w", op, rc.Name, errors.New("no actions"))
+		}
+
+		rule := Rule{Name: rc.Name, Effect: rc.Effect, Actions: rc.Actions}
+
+		if rc.Condition != "" {
+			expr, err := Compile(rc.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("%s: rule %s: %w", op, rc.Name, err)
+			}
+			rule.Condition = expr
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return New(rules), nil
+}
+
+// Decide evaluates the rules for in. A condition that fails to evaluate does
+// not match an allow rule but does match a deny rule, so errors fail closed.
+func (e *Engine) Decide(in Input) Decision {
+	attrs := map[string]interface{}{
+		"subject":  in.Subject,
+		"action":   in.Action,
+		"resource": in.Resource,
+		"context":  in.Context,
+	}
+
+	var allowedBy string
+
+	for _, rule := range e.rules {
+		if !Match(rule.Actions, in.Action) {
+			continue
+		}
+
+		matched := true
+		if rule.Condition != nil {
+			ok, err := rule.Condition.Eval(attrs)
+			matched = ok || err != nil && rule.Effect == EffectDeny
+		}
+
+		if !matched {
+			continue
+		}
+
+		if rule.Effect == EffectDeny {
+			return Decision{Allowed: false, Rule: rule.Name, Reason: "denied by rule"}
+		}
+
+		if allowedBy == "" {
+			allowedBy = rule.Name
+		}
+	}
+
+	if allowedBy == "" {
+		return Decision{Allowed: false, Reason: "no rule allows the action"}
+	}
+
+	return Decision{Allowed: true, Rule: allowedBy}
+}
+
+// Match reports whether name matches one of patterns. A "*" pattern matches
+// everything and "users:*" matches every name starting with "users:".
+func Match(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name || p == "*" {
+			return true
+		}
+
+		if prefix := strings.TrimSuffix(p, "*"); prefix != p && strings.HasSuffix(prefix, ":") && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SubjectFromClaims exposes verified access token claims as subject
+// attributes. Custom claims are included under their own names.
+func SubjectFromClaims(claims *auth.CustomClaims) map[string]interface{} {
+	subject := make(map[string]interface{}, len(claims.Extra)+6)
+	for k, v := range claims.Extra {
+		subject[k] = v
+	}
+
+	subject["sub"] = claims.Subject
+	subject["client_id"] = claims.ClientID
+	subject["tenant"] = claims.TenantID
+	subject["roles"] = stringsOrEmpty(claims.Roles)
+	subject["permissions"] = stringsOrEmpty(claims.Permissions)
+	subject["scopes"] = stringsOrEmpty(strings.Fields(claims.Scope))
+
+	if claims.Act != nil {
+		subject["act"] = map[string]interface{}{"sub": claims.Act.Subject}
+	}
+
+	return subject
+}
+
+func stringsOrEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
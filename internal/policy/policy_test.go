@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	e, err := NewFromConfig(config.Policy{Rules: []config.PolicyRule{
+		{
+			Name:      "support-revoke-tenant-sessions",
+			Effect:    EffectAllow,
+			Actions:   []string{"sessions:revoke"},
+			Condition: `"support" in subject.roles && subject.tenant == resource.tenant`,
+		},
+		{
+			Name:    "admins",
+			Effect:  EffectAllow,
+			Actions: []string{"sessions:*", "users:*"},
+			// A type error in an allow rule must not grant access.
+			Condition: `"admin" in subject.roles || subject.sub < 1`,
+		},
+		{
+			Name:      "no-self-lock",
+			Effect:    EffectDeny,
+			Actions:   []string{"users:lock"},
+			Condition: `subject.sub == resource.user_name`,
+		},
+	}})
+	require.NoError(t, err)
+
+	return e
+}
+
+func TestDecide(t *testing.T) {
+	e := newTestEngine(t)
+
+	support := SubjectFromClaims(&auth.CustomClaims{
+		Roles:    []string{"support"},
+		TenantID: "acme",
+	})
+	support["sub"] = "alice"
+
+	admin := map[string]interface{}{"sub": "root", "roles": []string{"admin"}}
+
+	tests := []struct {
+		name  string
+		in    Input
+		allow bool
+		rule  string
+	}{
+		{
+			name:  "support in tenant",
+			in:    Input{Subject: support, Action: "sessions:revoke", Resource: map[string]interface{}{"tenant": "acme"}},
+			allow: true,
+			rule:  "support-revoke-tenant-sessions",
+		},
+		{
+			name: "support in other tenant",
+			in:   Input{Subject: support, Action: "sessions:revoke", Resource: map[string]interface{}{"tenant": "other"}},
+		},
+		{
+			name: "support without rule for action",
+			in:   Input{Subject: support, Action: "users:lock"},
+		},
+		{
+			name:  "admin by wildcard",
+			in:    Input{Subject: admin, Action: "users:lock", Resource: map[string]interface{}{"user_name": "alice"}},
+			allow: true,
+			rule:  "admins",
+		},
+		{
+			name: "deny overrides allow",
+			in:   Input{Subject: admin, Action: "users:lock", Resource: map[string]interface{}{"user_name": "root"}},
+			rule: "no-self-lock",
+		},
+	}
+
+	for _, tt := range tests {
+		d := e.Decide(tt.in)
+		require.Equal(t, tt.allow, d.Allowed, tt.name)
+		require.Equal(t, tt.rule, d.Rule, tt.name)
+	}
+}
+
+func TestDenyFailsClosed(t *testing.T) {
+	e := New([]Rule{
+		{Name: "all", Effect: EffectAllow, Actions: []string{"*"}},
+		{Name: "broken", Effect: EffectDeny, Actions: []string{"*"}, Condition: mustCompile(t, `subject.sub < 1`)},
+	})
+
+	d := e.Decide(Input{Subject: map[string]interface{}{"sub": "alice"}, Action: "users:read"})
+	require.False(t, d.Allowed)
+	require.Equal(t, "broken", d.Rule)
+}
+
+func TestNewFromConfigError(t *testing.T) {
+	_, err := NewFromConfig(config.Policy{Rules: []config.PolicyRule{{Name: "bad", Effect: EffectAllow, Actions: []string{"*"}, Condition: "a =="}}})
+	require.Error(t, err)
+
+	_, err = NewFromConfig(config.Policy{Rules: []config.PolicyRule{{Name: "bad", Effect: "maybe", Actions: []string{"*"}}}})
+	require.Error(t, err)
+}
+
+func mustCompile(t *testing.T, src string) *Expr {
+	t.Helper()
+
+	expr, err := Compile(src)
+	require.NoError(t, err)
+
+	return expr
+}
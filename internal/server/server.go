@@ -2,17 +2,49 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ZiganshinDev/medods/internal/config"
+	"golang.org/x/exp/slog"
 )
 
+// Drainer is told when the server starts to stop, such as the readiness
+// probe.
+type Drainer interface {
+	Drain()
+}
+
 type Server struct {
 	httpServer *http.Server
+	drainer    Drainer
+	drainDelay time.Duration
+	log        *slog.Logger
+}
+
+type Option func(*Server)
+
+// WithDrainer makes Stop call d.Drain and then keep serving for
+// cfg.HTTPServer.DrainDelay, so load balancers notice before connections
+// are closed.
+func WithDrainer(d Drainer) Option {
+	return func(s *Server) {
+		s.drainer = d
+	}
 }
 
-func New(cfg *config.Config, router http.Handler) *Server {
-	return &Server{
+// WithLogger logs certificate reloads to log instead of the default logger.
+func WithLogger(log *slog.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+func New(cfg *config.Config, router http.Handler, opts ...Option) (*Server, error) {
+	const op = "server.New"
+
+	s := &Server{
 		httpServer: &http.Server{
 			Addr:         cfg.HTTPServer.Address,
 			Handler:      router,
@@ -20,13 +52,44 @@ func New(cfg *config.Config, router http.Handler) *Server {
 			WriteTimeout: cfg.HTTPServer.Timeout,
 			IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 		},
+		drainDelay: cfg.HTTPServer.DrainDelay,
+		log:        slog.Default(),
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if cfg.HTTPServer.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(cfg.HTTPServer.TLS, s.log)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		s.httpServer.TLSConfig = tlsConfig
+	}
+
+	return s, nil
 }
 
 func (s *Server) Run() error {
+	if s.httpServer.TLSConfig != nil {
+		// The certificate comes from TLSConfig.GetCertificate.
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
+
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Stop(ctx context.Context) error {
+	if s.drainer != nil {
+		s.drainer.Drain()
+
+		select {
+		case <-time.After(s.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
 	return s.httpServer.Shutdown(ctx)
 }
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"golang.org/x/exp/slog"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+func newTLSConfig(cfg config.TLS, log *slog.Logger) (*tls.Config, error) {
+	const op = "server.newTLSConfig"
+
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported min version %q", op, cfg.MinVersion)
+	}
+
+	cipherSuites, err := cipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval, log)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if cfg.ClientCAFile != "" {
+		clientAuth, ok := clientAuthTypes[cfg.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown client auth %q", op, cfg.ClientAuth)
+		}
+
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates in %s", op, cfg.ClientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = clientAuth
+	}
+
+	return tlsConfig, nil
+}
+
+// cipherSuites looks up suites by their standard names, such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Suites Go considers insecure are
+// refused. They only apply up to TLS 1.2.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// certReloader serves a certificate and key pair from disk, loading it
+// again when either file has changed. Files are checked at most once per
+// interval, on a handshake. A pair that fails to load is logged and the
+// previous one is kept.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, interval time.Duration, log *slog.Logger) (*certReloader, error) {
+	const op = "server.newCertReloader"
+
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("cert and key files are required"))
+	}
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, log: log}
+
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.load(modTime); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return c, nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= c.interval {
+		c.reload()
+	}
+
+	return c.cert, nil
+}
+
+func (c *certReloader) reload() {
+	c.checked = time.Now()
+
+	modTime, err := c.latestModTime()
+	if err != nil {
+		c.log.Error("failed to check TLS certificate", sl.Err(err))
+		return
+	}
+
+	if !modTime.After(c.modTime) {
+		return
+	}
+
+	if err := c.load(modTime); err != nil {
+		c.log.Error("failed to reload TLS certificate", sl.Err(err))
+		return
+	}
+
+	c.log.Info("reloaded TLS certificate", slog.String("file", c.certFile))
+}
+
+func (c *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+	c.checked = time.Now()
+
+	return nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate for cn signed by parent, or a self-signed
+// CA when parent is nil.
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, "test ca", nil)
+	ca.write(t, caFile, filepath.Join(dir, "ca.key"))
+	newTestCert(t, "localhost", ca).write(t, certFile, keyFile)
+	client := newTestCert(t, "billing", ca)
+
+	tlsConfig, err := newTLSConfig(config.TLS{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.2",
+		ClientCAFile: caFile,
+		ClientAuth:   "optional",
+	}, slog.Default())
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		TLSConfig: tlsConfig,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) > 0 {
+				_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+			}
+		}),
+	}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(certs ...tls.Certificate) string {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+
+		resp, err := c.Get("https://" + ln.Addr().String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	require.Equal(t, "billing", get(client.tlsCertificate()))
+	require.Equal(t, "", get())
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	ca := newTestCert(t, "test ca", nil)
+	first := newTestCert(t, "first", ca)
+	first.write(t, certFile, keyFile)
+
+	certs, err := newCertReloader(certFile, keyFile, 0, slog.Default())
+	require.NoError(t, err)
+
+	cert, err := certs.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	second := newTestCert(t, "second", ca)
+	second.write(t, certFile, keyFile)
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+
+	cert, err = certs.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.cert.Raw, cert.Certificate[0])
+
+	// A broken pair is not picked up.
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	later = later.Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+
+	cert, err = certs.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
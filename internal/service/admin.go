@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/metrics"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/ZiganshinDev/medods/internal/tracing"
+)
+
+var (
+	ErrUserLocked      = errors.New("user is locked")
+	ErrUserNotLocked   = errors.New("user is not locked")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+type UserLocks interface {
+	Lock(ctx context.Context, lock models.UserLock) error
+	Unlock(ctx context.Context, userName string) error
+	GetLock(ctx context.Context, userName string) (models.UserLock, error)
+}
+
+type Session struct {
+	ID          string    `json:"id"`
+	ClientID    string    `json:"client_id,omitempty"`
+	Scope       string    `json:"scope,omitempty"`
+	CreatedTime time.Time `json:"created_time"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type UserLockInfo struct {
+	Reason   string    `json:"reason,omitempty"`
+	LockedBy string    `json:"locked_by"`
+	LockedAt time.Time `json:"locked_at"`
+}
+
+type User struct {
+	Name     string        `json:"user_name"`
+	TenantID string        `json:"tenant_id,omitempty"`
+	Sessions int           `json:"sessions"`
+	Lock     *UserLockInfo `json:"lock,omitempty"`
+}
+
+// CheckUserActive returns ErrUserLocked for a locked user.
+func (s *Service) CheckUserActive(ctx context.Context, userName string) error {
+	const op = "service.CheckUserActive"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	_, err := s.locks.GetLock(ctx, userName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fmt.Errorf("%s: %w", op, ErrUserLocked)
+}
+
+// User is an overview of a user for operators. Users are not stored on their
+// own, so an unknown name is reported as a user without sessions.
+func (s *Service) User(ctx context.Context, userName string) (User, error) {
+	const op = "service.User"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	sessions, err := s.storage.ListTokensByUser(ctx, userName)
+	if err != nil {
+		return User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user := User{Name: userName, TenantID: tenant.ID(ctx), Sessions: len(sessions)}
+
+	lock, err := s.locks.GetLock(ctx, userName)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err == nil {
+		user.Lock = &UserLockInfo{Reason: lock.Reason, LockedBy: lock.LockedBy, LockedAt: lock.LockedAt}
+	}
+
+	return user, nil
+}
+
+func (s *Service) Sessions(ctx context.Context, userName string) ([]Session, error) {
+	const op = "service.Sessions"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	users, err := s.storage.ListTokensByUser(ctx, userName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ttl := s.RefreshTokenTTL(ctx)
+
+	sessions := make([]Session, 0, len(users))
+	for _, u := range users {
+		sessions = append(sessions, Session{
+			ID:          u.ID.Hex(),
+			ClientID:    u.ClientID,
+			Scope:       u.Scope,
+			CreatedTime: u.CreatedTime,
+			ExpiresAt:   u.CreatedTime.Add(ttl),
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSessions deletes one session of a user, or all of them when id is empty.
+// Access tokens already issued stay valid until they expire.
+func (s *Service) RevokeSessions(ctx context.Context, userName string, id string) error {
+	const op = "service.RevokeSessions"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if id == "" {
+		if err := s.storage.DeleteTokensByUser(ctx, userName); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		s.metrics.Revoked(metrics.TokenSession)
+		s.auditor.Record(ctx, models.AuditEvent{Type: audit.Revoke, Subject: userName, Reason: "all_sessions"})
+		s.events.Publish(ctx, Event{Type: EventSessionRevoked, Subject: userName, Reason: "all_sessions"})
+
+		return nil
+	}
+
+	err := s.storage.DeleteTokenByID(ctx, userName, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.metrics.Revoked(metrics.TokenSession)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Revoke, Subject: userName, SessionID: id, Reason: "session"})
+	s.events.Publish(ctx, Event{Type: EventSessionRevoked, Subject: userName, SessionID: id, Reason: "session"})
+
+	return nil
+}
+
+// LockUser stops a user from getting new tokens and ends their sessions.
+// Access tokens of a locked user no longer pass VerifyAccessToken.
+func (s *Service) LockUser(ctx context.Context, userName string, reason string, lockedBy string) error {
+	const op = "service.LockUser"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := s.locks.Lock(ctx, models.UserLock{
+		UserName: userName,
+		TenantID: tenant.ID(ctx),
+		Reason:   reason,
+		LockedBy: lockedBy,
+		LockedAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.storage.DeleteTokensByUser(ctx, userName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Lock, Actor: lockedBy, Subject: userName, Reason: reason})
+	s.events.Publish(ctx, Event{Type: EventSessionRevoked, Subject: userName, Reason: "user_locked"})
+
+	return nil
+}
+
+func (s *Service) UnlockUser(ctx context.Context, userName string) error {
+	const op = "service.UnlockUser"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	err := s.locks.Unlock(ctx, userName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrUserNotLocked)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Unlock, Subject: userName})
+
+	return nil
+}
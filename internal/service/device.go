@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+)
+
+type DeviceStorage interface {
+	InsertDeviceCode(ctx context.Context, code models.DeviceCode) error
+	GetDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error)
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	RecordDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval int64) error
+	DecideDeviceCode(ctx context.Context, code models.DeviceCode) error
+	TakeApprovedDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error)
+}
+
+// slowDownStep is how much the polling interval grows after a slow_down, per RFC 8628 section 3.5.
+const slowDownStep = 5
+
+func (o *OAuth) DeviceAuthorization(ctx context.Context, creds oauth.ClientCredentials, scope string) (oauth.DeviceAuthorizationResponse, error) {
+	const op = "service.OAuth.DeviceAuthorization"
+
+	client, err := o.AuthenticateClient(ctx, creds)
+	if err != nil {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !hasGrantType(client, oauth.GrantDeviceCode) {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, ""))
+	}
+
+	granted, err := grantedScope(client, scope)
+	if err != nil {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCode, err := o.tokenManager.NewCode()
+	if err != nil {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	userCode, err := oauth.NewUserCode()
+	if err != nil {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	interval := int64(o.cfg.OAuth.DevicePollInterval.Seconds())
+
+	if err := o.devices.InsertDeviceCode(ctx, models.DeviceCode{
+		DeviceCodeHash: hashValue(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ID,
+		Scope:          granted,
+		Status:         models.DeviceCodePending,
+		TenantID:       tenant.ID(ctx),
+		Interval:       interval,
+		ExpiresAt:      now.Add(o.cfg.OAuth.DeviceCodeTTL),
+		CreatedTime:    now,
+	}); err != nil {
+		return oauth.DeviceAuthorizationResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	verificationURI := strings.TrimSuffix(o.cfg.JWT.Issuer, "/") + "/device"
+
+	return oauth.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               int64(o.cfg.OAuth.DeviceCodeTTL.Seconds()),
+		Interval:                interval,
+	}, nil
+}
+
+// DeviceVerification describes a pending device request so the user can
+// check what they are about to approve.
+func (o *OAuth) DeviceVerification(ctx context.Context, userCode string) (oauth.DeviceVerification, error) {
+	const op = "service.OAuth.DeviceVerification"
+
+	code, err := o.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return oauth.DeviceVerification{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client, err := o.clients.GetClient(ctx, code.ClientID)
+	if err != nil {
+		return oauth.DeviceVerification{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oauth.DeviceVerification{
+		UserCode:   code.UserCode,
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scope:      code.Scope,
+	}, nil
+}
+
+// ApproveDevice approves or denies a pending user code for userName, who
+// authenticated at authTime.
+func (o *OAuth) ApproveDevice(ctx context.Context, userName string, authTime time.Time, userCode string, approve bool) error {
+	const op = "service.OAuth.ApproveDevice"
+
+	code, err := o.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	code.Status = models.DeviceCodeDenied
+	if approve {
+		code.Status = models.DeviceCodeApproved
+		code.UserName = userName
+		code.AuthTime = authTime
+	}
+
+	err = o.devices.DecideDeviceCode(ctx, code)
+	if errors.Is(err, storage.ErrConflict) {
+		return fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "user_code was already approved or denied"))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (o *OAuth) pendingDeviceCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "service.OAuth.pendingDeviceCode"
+
+	code, err := o.devices.GetDeviceCodeByUserCode(ctx, oauth.NormalizeUserCode(userCode))
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "unknown user_code"))
+	}
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if code.TenantID != tenant.ID(ctx) {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "unknown user_code"))
+	}
+
+	if code.Status != models.DeviceCodePending || code.ExpiresAt.Before(time.Now()) {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "user_code is no longer valid"))
+	}
+
+	return code, nil
+}
+
+func (o *OAuth) deviceCodeGrant(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.deviceCodeGrant"
+
+	if req.DeviceCode == "" {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "device_code is required"))
+	}
+
+	client, err := o.AuthenticateClient(ctx, req.Client)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := o.devices.GetDeviceCode(ctx, hashValue(req.DeviceCode))
+	if errors.Is(err, storage.ErrNotFound) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "unknown device_code"))
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	switch {
+	case code.ClientID != client.ID:
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "device_code was issued to another client"))
+	case code.TenantID != tenant.ID(ctx):
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "device_code was issued for another tenant"))
+	case code.ExpiresAt.Before(now):
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrExpiredToken, ""))
+	case code.Status == models.DeviceCodeDenied:
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrAccessDenied, ""))
+	case code.Status == models.DeviceCodePending:
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, o.pollDeviceCode(ctx, code, now))
+	}
+
+	code, err = o.devices.TakeApprovedDeviceCode(ctx, code.DeviceCodeHash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "device_code already used"))
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := o.issueTokens(ctx, code.UserName, client.ID, code.Scope, code.AuthTime)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp, nil
+}
+
+// pollDeviceCode records a poll of a pending code and returns the error the
+// client should see: slow_down if it polled faster than the interval.
+func (o *OAuth) pollDeviceCode(ctx context.Context, code models.DeviceCode, now time.Time) error {
+	result := oauth.NewError(oauth.ErrAuthorizationPending, "")
+
+	if !code.LastPolledAt.IsZero() && now.Sub(code.LastPolledAt) < time.Duration(code.Interval)*time.Second {
+		code.Interval += slowDownStep
+		result = oauth.NewError(oauth.ErrSlowDown, "")
+	}
+
+	if err := o.devices.RecordDevicePoll(ctx, code.DeviceCodeHash, now, code.Interval); err != nil {
+		return err
+	}
+
+	return result
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event types published on the EventBus.
+const (
+	EventUserLoggedIn       = "user.logged_in"
+	EventSessionRevoked     = "session.revoked"
+	EventTokenReuseDetected = "token.reuse_detected"
+)
+
+// Event is something that happened in the service that other systems may want
+// to react to.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// EventHandler reacts to an event. It is called on the publishing goroutine,
+// so it must not block.
+type EventHandler func(ctx context.Context, event Event)
+
+type subscription struct {
+	types  []string
+	handle EventHandler
+}
+
+func (s subscription) wants(eventType string) bool {
+	return len(s.types) == 0 || containsString(s.types, eventType)
+}
+
+// EventBus passes published events to their subscribers. A nil *EventBus
+// drops every event.
+type EventBus struct {
+	mu            sync.RWMutex
+	subscriptions []subscription
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe calls h for events of the given types, or for all events when
+// none are given.
+func (b *EventBus) Subscribe(h EventHandler, types ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscriptions = append(b.subscriptions, subscription{types: types, handle: h})
+}
+
+// Publish fills in the ID, time and tenant of event and passes it to the
+// subscribers.
+func (b *EventBus) Publish(ctx context.Context, event Event) {
+	if b == nil {
+		return
+	}
+
+	event.ID = primitive.NewObjectID().Hex()
+	event.Time = time.Now().UTC()
+	event.TenantID = tenant.ID(ctx)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, s := range b.subscriptions {
+		if s.wants(event.Type) {
+			s.handle(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+)
+
+// Token exchange modes, recorded as the reason of their audit events.
+const (
+	exchangeDelegation    = "delegation"
+	exchangeImpersonation = "impersonation"
+)
+
+// tokenExchange implements the RFC 8693 grant. With an actor token the new
+// token is delegated and carries an act claim naming the actor; without one
+// the client impersonates the subject and the token says so in
+// impersonated_by. Each is allowed by the client's policy, and every exchange
+// of a valid subject token is audited with the client as the actor.
+func (o *OAuth) tokenExchange(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.tokenExchange"
+
+	client, err := o.AuthenticateClient(ctx, req.Client)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !client.Confidential() || !hasGrantType(client, oauth.GrantTokenExchange) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, ""))
+	}
+
+	if req.RequestedTokenType != "" && req.RequestedTokenType != oauth.TokenTypeIDAccessToken {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "unsupported requested_token_type"))
+	}
+
+	subject, err := o.verifyExchangeToken(ctx, req.SubjectToken, req.SubjectTokenType)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: subject_token: %w", op, err)
+	}
+
+	mode := exchangeImpersonation
+	if req.ActorToken != "" {
+		mode = exchangeDelegation
+	}
+
+	resp, err := o.exchangeToken(ctx, client, subject, mode, req)
+
+	event := models.AuditEvent{Type: audit.TokenExchange, Actor: client.ID, Subject: subject.Subject, ClientID: client.ID, Reason: mode}
+	if err != nil {
+		event.Outcome = audit.Failure
+	}
+	o.service.auditor.Record(ctx, event)
+
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp, nil
+}
+
+func (o *OAuth) exchangeToken(ctx context.Context, client models.Client, subject *auth.CustomClaims, mode string, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	opts := []auth.ClaimsOption{auth.WithClientID(client.ID)}
+
+	switch mode {
+	case exchangeDelegation:
+		if !client.TokenExchange.Delegation {
+			return oauth.TokenResponse{}, oauth.NewError(oauth.ErrUnauthorizedClient, "delegation is not allowed")
+		}
+
+		actorClaims, err := o.verifyExchangeToken(ctx, req.ActorToken, req.ActorTokenType)
+		if err != nil {
+			return oauth.TokenResponse{}, fmt.Errorf("actor_token: %w", err)
+		}
+
+		opts = append(opts, auth.WithActor(&auth.Actor{Subject: actorClaims.Subject, Act: subject.Act}))
+	case exchangeImpersonation:
+		if !client.TokenExchange.Impersonation {
+			return oauth.TokenResponse{}, oauth.NewError(oauth.ErrUnauthorizedClient, "impersonation is not allowed")
+		}
+
+		opts = append(opts, auth.WithActor(nil), auth.WithImpersonator(client.ID))
+	}
+
+	if err := checkAudience(client, req.Audience); err != nil {
+		return oauth.TokenResponse{}, err
+	}
+
+	scope, err := exchangedScope(client, subject.Scope, req.Scope)
+	if err != nil {
+		return oauth.TokenResponse{}, err
+	}
+
+	// The new token must not outlive the one it was derived from.
+	ttl := o.service.AccessTokenTTL(ctx)
+	if remaining := time.Until(time.Unix(subject.ExpiresAt, 0)); remaining < ttl {
+		ttl = remaining
+	}
+
+	opts = append(opts, auth.WithScope(scope))
+	if req.Audience != "" {
+		opts = append(opts, auth.WithAudience(req.Audience))
+	}
+
+	accessToken, err := o.service.NewAccessToken(ctx, subject.Subject, ttl, opts...)
+	if err != nil {
+		return oauth.TokenResponse{}, err
+	}
+
+	return oauth.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: oauth.TokenTypeIDAccessToken,
+		TokenType:       tokenType(ctx),
+		ExpiresIn:       int64(ttl.Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+func (o *OAuth) verifyExchangeToken(ctx context.Context, token string, tokenType string) (*auth.CustomClaims, error) {
+	if token == "" {
+		return nil, oauth.NewError(oauth.ErrInvalidRequest, "token is required")
+	}
+
+	if tokenType != oauth.TokenTypeIDAccessToken && tokenType != oauth.TokenTypeIDJWT {
+		return nil, oauth.NewError(oauth.ErrInvalidRequest, "unsupported token type")
+	}
+
+	claims, err := o.service.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "token is not active")
+	}
+
+	return claims, nil
+}
+
+func checkAudience(client models.Client, audience string) error {
+	if len(client.TokenExchange.Audiences) == 0 {
+		return nil
+	}
+
+	if audience == "" {
+		return oauth.NewError(oauth.ErrInvalidTarget, "audience is required")
+	}
+
+	if !containsString(client.TokenExchange.Audiences, audience) {
+		return oauth.NewError(oauth.ErrInvalidTarget, "audience is not allowed")
+	}
+
+	return nil
+}
+
+// exchangedScope only narrows scope: the result is limited to the subject
+// token's scope, or to the client's scopes for first-party tokens without one.
+func exchangedScope(client models.Client, subjectScope string, requested string) (string, error) {
+	allowed := oauth.ParseScope(subjectScope)
+	if len(allowed) == 0 {
+		allowed = client.Scopes
+	}
+
+	scopes := oauth.ParseScope(requested)
+	if len(scopes) == 0 {
+		return oauth.FormatScope(allowed), nil
+	}
+
+	if !oauth.ContainsAll(allowed, scopes) {
+		return "", oauth.NewError(oauth.ErrInvalidScope, "")
+	}
+
+	return oauth.FormatScope(scopes), nil
+}
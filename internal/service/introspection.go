@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/storage"
+)
+
+// Introspect reports whether token is active. Only confidential clients may
+// introspect; token_type_hint only decides which lookup is tried first.
+func (o *OAuth) Introspect(ctx context.Context, creds oauth.ClientCredentials, token string, hint string) (oauth.IntrospectionResponse, error) {
+	const op = "service.OAuth.Introspect"
+
+	client, err := o.AuthenticateClient(ctx, creds)
+	if err != nil {
+		return oauth.IntrospectionResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !client.Confidential() {
+		return oauth.IntrospectionResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, ""))
+	}
+
+	if token == "" {
+		return oauth.IntrospectionResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+	}
+
+	lookups := []func(context.Context, string) (oauth.IntrospectionResponse, error){
+		o.introspectAccessToken,
+		o.introspectRefreshToken,
+	}
+	if hint == oauth.TokenTypeRefresh {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		resp, err := lookup(ctx, token)
+		if err != nil {
+			return oauth.IntrospectionResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if resp.Active {
+			return resp, nil
+		}
+	}
+
+	return oauth.IntrospectionResponse{Active: false}, nil
+}
+
+func (o *OAuth) introspectAccessToken(ctx context.Context, token string) (oauth.IntrospectionResponse, error) {
+	claims, err := o.service.verifyIssuedToken(ctx, token)
+	if err != nil {
+		return oauth.IntrospectionResponse{Active: false}, nil
+	}
+
+	return oauth.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		TokenType: oauth.TokenTypeAccess,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Cnf:       claims.Cnf,
+
+		ImpersonatedBy: claims.ImpersonatedBy,
+	}, nil
+}
+
+func (o *OAuth) introspectRefreshToken(ctx context.Context, token string) (oauth.IntrospectionResponse, error) {
+	const op = "service.OAuth.introspectRefreshToken"
+
+	user, err := o.service.LookupRefreshToken(ctx, token)
+	if errors.Is(err, storage.ErrNotFound) {
+		return oauth.IntrospectionResponse{Active: false}, nil
+	}
+	if err != nil {
+		return oauth.IntrospectionResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oauth.IntrospectionResponse{
+		Active:    true,
+		Scope:     user.Scope,
+		ClientID:  user.ClientID,
+		Subject:   user.Name,
+		TokenType: oauth.TokenTypeRefresh,
+		ExpiresAt: user.CreatedTime.Add(o.service.RefreshTokenTTL(ctx)).Unix(),
+		IssuedAt:  user.CreatedTime.Unix(),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"golang.org/x/exp/slog"
+)
+
+var ErrNoKeyEncryptionKey = errors.New("KEY_ENCRYPTION_KEY is not set")
+
+type KeyStorage interface {
+	SaveKey(ctx context.Context, key models.SigningKey) error
+	GetKeys(ctx context.Context, limit int64) ([]models.SigningKey, error)
+}
+
+// Keys persists ID token signing keys created by rotation, so they survive
+// restarts. The private keys are stored encrypted with a key that only the
+// instances have. Every instance reloads the stored keys with Watch, so a key
+// rotated on one of them is soon used and published by all.
+//
+// Access tokens are signed with JWT_SIGNING_KEY (HS512), which is not rotated
+// here. Changing it means restarting every instance with the new value, and
+// ends the access tokens signed with the old one.
+type Keys struct {
+	storage      KeyStorage
+	tokenManager TokenManager
+	secret       string
+	configured   []auth.Key
+}
+
+// NewKeys stores keys encrypted with secret. The ID token keys tokenManager
+// has now are kept behind the stored ones.
+func NewKeys(storage KeyStorage, tokenManager TokenManager, secret string) (*Keys, error) {
+	return &Keys{
+		storage:      storage,
+		tokenManager: tokenManager,
+		secret:       secret,
+		configured:   tokenManager.IDTokenKeys(),
+	}, nil
+}
+
+// Restore makes the stored keys, newest first, and then the configured ones
+// the ID token keys, and returns how many were stored.
+func (k *Keys) Restore(ctx context.Context) (int, error) {
+	const op = "service.Keys.Restore"
+
+	stored, err := k.storage.GetKeys(ctx, auth.MaxKeys)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(stored) > 0 && k.secret == "" {
+		return 0, fmt.Errorf("%s: %w", op, ErrNoKeyEncryptionKey)
+	}
+
+	keys := make([]auth.Key, 0, len(stored)+len(k.configured))
+	for _, s := range stored {
+		private, err := auth.DecryptPrivateKey(s.EncryptedKey, k.secret, s.ID)
+		if err != nil {
+			return 0, fmt.Errorf("%s: key %s: %w", op, s.ID, err)
+		}
+
+		key := auth.NewKey(private)
+		key.CreatedAt = s.CreatedTime
+
+		keys = append(keys, key)
+	}
+
+	k.tokenManager.SetIDTokenKeys(append(keys, k.configured...)...)
+
+	return len(stored), nil
+}
+
+// Watch calls Restore every interval until ctx is done. When it fails, the
+// keys stay as they were.
+func (k *Keys) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := k.Restore(ctx); err != nil {
+				logctx.FromContext(ctx).Error("failed to reload signing keys", sl.Err(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (k *Keys) Rotate(ctx context.Context) (auth.Key, error) {
+	const op = "service.Keys.Rotate"
+
+	if k.secret == "" {
+		return auth.Key{}, fmt.Errorf("%s: %w", op, ErrNoKeyEncryptionKey)
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := auth.EncryptPrivateKey(key.Private, k.secret, key.ID)
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := k.storage.SaveKey(ctx, models.SigningKey{
+		ID:           key.ID,
+		EncryptedKey: sealed,
+		CreatedTime:  key.CreatedAt,
+	}); err != nil {
+		return auth.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	k.tokenManager.RotateKey(key)
+	logctx.FromContext(ctx).Info("rotated id token signing key", slog.String("kid", key.ID))
+
+	return key, nil
+}
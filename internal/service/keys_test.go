@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+type keyStore struct {
+	mu   sync.Mutex
+	keys []models.SigningKey
+}
+
+func (s *keyStore) SaveKey(_ context.Context, key models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = append([]models.SigningKey{key}, s.keys...)
+
+	return nil
+}
+
+func (s *keyStore) GetKeys(_ context.Context, limit int64) ([]models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if int64(len(s.keys)) > limit {
+		return s.keys[:limit], nil
+	}
+
+	return s.keys, nil
+}
+
+func newKeyManager(t *testing.T) (*auth.Manager, auth.Key) {
+	configured, err := auth.GenerateKey()
+	require.NoError(t, err)
+
+	m, err := auth.New("qwerty", configured)
+	require.NoError(t, err)
+
+	return m, configured
+}
+
+func TestKeysRotatedKeyIsReloadedElsewhere(t *testing.T) {
+	store := &keyStore{}
+
+	first, configured := newKeyManager(t)
+	second, _ := newKeyManager(t)
+
+	rotating, err := NewKeys(store, first, "secret")
+	require.NoError(t, err)
+	reloading, err := NewKeys(store, second, "secret")
+	require.NoError(t, err)
+
+	key, err := rotating.Rotate(context.Background())
+	require.NoError(t, err)
+	require.NotContains(t, string(store.keys[0].EncryptedKey), "PRIVATE KEY")
+
+	restored, err := reloading.Restore(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, restored)
+
+	keys := second.IDTokenKeys()
+	require.Len(t, keys, 2)
+	require.Equal(t, key.ID, keys[0].ID)
+
+	// The configured key of the first instance stays behind the rotated one.
+	keys = first.IDTokenKeys()
+	require.Equal(t, key.ID, keys[0].ID)
+	require.Equal(t, configured.ID, keys[1].ID)
+}
+
+func TestKeysNeedEncryptionKey(t *testing.T) {
+	store := &keyStore{}
+	m, _ := newKeyManager(t)
+
+	keys, err := NewKeys(store, m, "")
+	require.NoError(t, err)
+
+	_, err = keys.Rotate(context.Background())
+	require.ErrorIs(t, err, ErrNoKeyEncryptionKey)
+
+	rotating, err := NewKeys(store, m, "secret")
+	require.NoError(t, err)
+	_, err = rotating.Rotate(context.Background())
+	require.NoError(t, err)
+
+	_, err = keys.Restore(context.Background())
+	require.ErrorIs(t, err, ErrNoKeyEncryptionKey)
+
+	wrong, err := NewKeys(store, m, "wrong")
+	require.NoError(t, err)
+	_, err = wrong.Restore(context.Background())
+	require.Error(t, err)
+}
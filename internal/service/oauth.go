@@ -0,0 +1,500 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+)
+
+type ClientStorage interface {
+	GetClient(ctx context.Context, clientID string) (models.Client, error)
+	SaveClient(ctx context.Context, client models.Client) error
+}
+
+type CodeStorage interface {
+	InsertCode(ctx context.Context, code models.AuthorizationCode) error
+	TakeCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error)
+}
+
+type OAuth struct {
+	cfg          *config.Config
+	clients      ClientStorage
+	codes        CodeStorage
+	devices      DeviceStorage
+	tokenManager TokenManager
+	service      *Service
+}
+
+func NewOAuth(cfg *config.Config, clients ClientStorage, codes CodeStorage, devices DeviceStorage, tokenManager TokenManager, service *Service) (*OAuth, error) {
+	return &OAuth{
+		cfg:          cfg,
+		clients:      clients,
+		codes:        codes,
+		devices:      devices,
+		tokenManager: tokenManager,
+		service:      service}, nil
+}
+
+func (o *OAuth) RegisterClients(ctx context.Context, clients []config.OAuthClient) error {
+	const op = "service.OAuth.RegisterClients"
+
+	for _, c := range clients {
+		grantTypes := c.GrantTypes
+		if len(grantTypes) == 0 {
+			grantTypes = []string{oauth.GrantAuthorizationCode}
+		}
+
+		client := models.Client{
+			ID:           c.ID,
+			Name:         c.Name,
+			SecretHash:   c.SecretHash,
+			RedirectURIs: c.RedirectURIs,
+			Scopes:       c.Scopes,
+			GrantTypes:   grantTypes,
+			TLSSubject:   c.TLSSubject,
+			CreatedTime:  time.Now(),
+			TokenExchange: models.TokenExchangePolicy{
+				Audiences:     c.TokenExchange.Audiences,
+				Delegation:    c.TokenExchange.Delegation,
+				Impersonation: c.TokenExchange.Impersonation,
+			},
+		}
+
+		if err := o.clients.SaveClient(ctx, client); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// ResolveRedirectURI checks the client and its redirect URI. Errors returned here
+// must be shown to the user instead of being sent to the redirect URI.
+func (o *OAuth) ResolveRedirectURI(ctx context.Context, clientID string, redirectURI string) (string, error) {
+	const op = "service.OAuth.ResolveRedirectURI"
+
+	client, err := o.getClient(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if redirectURI == "" {
+		if len(client.RedirectURIs) != 1 {
+			return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "redirect_uri is required"))
+		}
+
+		return client.RedirectURIs[0], nil
+	}
+
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			return redirectURI, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "redirect_uri is not registered"))
+}
+
+func (o *OAuth) Authorize(ctx context.Context, userName string, authTime time.Time, req oauth.AuthorizeRequest) (string, error) {
+	const op = "service.OAuth.Authorize"
+
+	if req.ResponseType != oauth.ResponseTypeCode {
+		return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnsupportedResponseType, ""))
+	}
+
+	if req.CodeChallenge == "" {
+		return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "code_challenge is required"))
+	}
+
+	if req.CodeChallengeMethod != oauth.ChallengeS256 {
+		return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "code_challenge_method must be S256"))
+	}
+
+	client, err := o.getClient(ctx, req.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !hasGrantType(client, oauth.GrantAuthorizationCode) {
+		return "", fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, ""))
+	}
+
+	scope, err := grantedScope(client, req.Scope)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := o.tokenManager.NewCode()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	if err := o.codes.InsertCode(ctx, models.AuthorizationCode{
+		CodeHash:            hashValue(code),
+		ClientID:            client.ID,
+		UserName:            userName,
+		RedirectURI:         req.RedirectURI,
+		Scope:               scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            authTime,
+		TenantID:            tenant.ID(ctx),
+		ExpiresAt:           now.Add(o.cfg.OAuth.CodeTTL),
+		CreatedTime:         now,
+	}); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+func (o *OAuth) Token(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.Token"
+
+	var (
+		resp oauth.TokenResponse
+		err  error
+	)
+
+	switch req.GrantType {
+	case oauth.GrantAuthorizationCode:
+		resp, err = o.exchangeCode(ctx, req)
+	case oauth.GrantClientCredentials:
+		resp, err = o.clientCredentials(ctx, req)
+	case oauth.GrantDeviceCode:
+		resp, err = o.deviceCodeGrant(ctx, req)
+	case oauth.GrantTokenExchange:
+		resp, err = o.tokenExchange(ctx, req)
+	case oauth.GrantRefreshToken:
+		resp, err = o.refreshTokenGrant(ctx, req)
+	case "":
+		err = oauth.NewError(oauth.ErrInvalidRequest, "grant_type is required")
+	default:
+		err = oauth.NewError(oauth.ErrUnsupportedGrantType, "")
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp, nil
+}
+
+func (o *OAuth) exchangeCode(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.exchangeCode"
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "code and code_verifier are required"))
+	}
+
+	client, err := o.AuthenticateClient(ctx, req.Client)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := o.codes.TakeCode(ctx, hashValue(req.Code))
+	if errors.Is(err, storage.ErrNotFound) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "unknown or already used code"))
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case code.ExpiresAt.Before(time.Now()):
+		err = oauth.NewError(oauth.ErrInvalidGrant, "code expired")
+	case code.ClientID != client.ID:
+		err = oauth.NewError(oauth.ErrInvalidGrant, "code was issued to another client")
+	case code.TenantID != tenant.ID(ctx):
+		err = oauth.NewError(oauth.ErrInvalidGrant, "code was issued for another tenant")
+	case code.RedirectURI != req.RedirectURI:
+		err = oauth.NewError(oauth.ErrInvalidGrant, "redirect_uri mismatch")
+	case !oauth.VerifyPKCE(req.CodeVerifier, code.CodeChallenge, code.CodeChallengeMethod):
+		err = oauth.NewError(oauth.ErrInvalidGrant, "code_verifier mismatch")
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := o.issueTokens(ctx, code.UserName, client.ID, code.Scope, code.AuthTime)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if oauth.HasScope(code.Scope, oauth.ScopeOpenID) {
+		resp.IDToken, err = o.newIDToken(code.UserName, client.ID, code.Nonce, code.AuthTime, resp.AccessToken)
+		if err != nil {
+			return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (o *OAuth) clientCredentials(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.clientCredentials"
+
+	client, err := o.AuthenticateClient(ctx, req.Client)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !client.Confidential() || !hasGrantType(client, oauth.GrantClientCredentials) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, ""))
+	}
+
+	scope, err := grantedScope(client, req.Scope)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ttl := o.service.AccessTokenTTL(ctx)
+
+	accessToken, err := o.service.NewClientAccessToken(ctx, client.ID, ttl, auth.WithScope(scope))
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oauth.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(ctx),
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// AuthenticateClient checks the client secret, or the TLS client certificate,
+// of confidential clients. Public clients only identify themselves and must
+// not send a secret; a certificate they present is ignored.
+func (o *OAuth) AuthenticateClient(ctx context.Context, creds oauth.ClientCredentials) (models.Client, error) {
+	const op = "service.OAuth.AuthenticateClient"
+
+	if creds.ID == "" {
+		return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidClient, "client authentication is required"))
+	}
+
+	client, err := o.clients.GetClient(ctx, creds.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidClient, ""))
+	}
+	if err != nil {
+		return models.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if creds.Method == oauth.AuthMethodTLSClient {
+		if !client.Confidential() {
+			return client, nil
+		}
+
+		if client.TLSSubject == "" || creds.Certificate.Subject.CommonName != client.TLSSubject {
+			return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidClient, ""))
+		}
+
+		return client, nil
+	}
+
+	if !client.Confidential() {
+		if creds.Method != oauth.AuthMethodNone {
+			return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidClient, "public client must not send a secret"))
+		}
+
+		return client, nil
+	}
+
+	if creds.Method == oauth.AuthMethodNone || !o.service.compareTokens(ctx, creds.Secret, []byte(client.SecretHash)) {
+		return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidClient, ""))
+	}
+
+	return client, nil
+}
+
+// refreshTokenGrant rotates a refresh token the client was issued by another
+// grant (RFC 6749 section 6). The new tokens carry the session's scope, or a
+// narrower one if the client asks for it.
+func (o *OAuth) refreshTokenGrant(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.refreshTokenGrant"
+
+	if req.RefreshToken == "" {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "refresh_token is required"))
+	}
+
+	client, err := o.AuthenticateClient(ctx, req.Client)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session, err := o.service.LookupRefreshToken(ctx, req.RefreshToken)
+	if errors.Is(err, storage.ErrNotFound) && o.service.detectReuse(ctx, req.RefreshToken) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "refresh_token was already used"))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "unknown or expired refresh_token"))
+	}
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// First-party sessions have no client and are refreshed at /refresh.
+	if session.ClientID != client.ID {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "refresh_token was issued to another client"))
+	}
+
+	if err := checkSessionKey(ctx, session); err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "refresh_token is bound to another DPoP key"))
+	}
+
+	scope := session.Scope
+	if req.Scope != "" {
+		if !oauth.ContainsAll(oauth.ParseScope(session.Scope), oauth.ParseScope(req.Scope)) {
+			return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidScope, ""))
+		}
+
+		scope = req.Scope
+	}
+
+	if err := o.checkUserActive(ctx, session.Name); err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refreshToken, err := o.service.GetRefreshToken(session.Name)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := o.service.rotateSession(ctx, session, refreshToken); errors.Is(err, ErrTokenReused) {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidGrant, "refresh_token was already used"))
+	} else if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := o.tokenResponse(ctx, session.Name, client.ID, scope, session.AuthTime, refreshToken)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp, nil
+}
+
+func (o *OAuth) issueTokens(ctx context.Context, userName string, clientID string, scope string, authTime time.Time) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.issueTokens"
+
+	if err := o.checkUserActive(ctx, userName); err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A new grant replaces the client's earlier session only, so that signing
+	// in to one client does not sign the user out of the others.
+	if err := o.service.storage.DeleteTokensByClient(ctx, userName, clientID); err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refreshToken, err := o.service.GetRefreshToken(userName)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.service.InsertGrantToken(ctx, refreshToken, userName, clientID, scope, authTime); err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := o.tokenResponse(ctx, userName, clientID, scope, authTime, refreshToken)
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resp, nil
+}
+
+// tokenResponse signs the access token of a user's session with clientID.
+func (o *OAuth) tokenResponse(ctx context.Context, userName string, clientID string, scope string, authTime time.Time, refreshToken string) (oauth.TokenResponse, error) {
+	const op = "service.OAuth.tokenResponse"
+
+	ttl := o.service.AccessTokenTTL(ctx)
+
+	accessToken, err := o.service.NewAccessToken(ctx, userName, ttl, auth.WithScope(scope), auth.WithClientID(clientID), auth.WithAuthTime(authTime))
+	if err != nil {
+		return oauth.TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oauth.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    tokenType(ctx),
+		ExpiresIn:    int64(ttl.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}, nil
+}
+
+// checkUserActive is Service.CheckUserActive as an OAuth error.
+func (o *OAuth) checkUserActive(ctx context.Context, userName string) error {
+	err := o.service.CheckUserActive(ctx, userName)
+	if errors.Is(err, ErrUserLocked) {
+		return oauth.NewError(oauth.ErrInvalidGrant, "user is locked")
+	}
+
+	return err
+}
+
+func (o *OAuth) getClient(ctx context.Context, clientID string) (models.Client, error) {
+	const op = "service.OAuth.getClient"
+
+	if clientID == "" {
+		return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "client_id is required"))
+	}
+
+	client, err := o.clients.GetClient(ctx, clientID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.Client{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "unknown client_id"))
+	}
+	if err != nil {
+		return models.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, nil
+}
+
+func grantedScope(client models.Client, requested string) (string, error) {
+	scopes := oauth.ParseScope(requested)
+	if len(scopes) == 0 {
+		return oauth.FormatScope(client.Scopes), nil
+	}
+
+	allowed := client.Scopes
+	if hasGrantType(client, oauth.GrantAuthorizationCode) {
+		allowed = append([]string{oauth.ScopeOpenID, oauth.ScopeProfile}, allowed...)
+	}
+
+	if !oauth.ContainsAll(allowed, scopes) {
+		return "", oauth.NewError(oauth.ErrInvalidScope, "")
+	}
+
+	return oauth.FormatScope(scopes), nil
+}
+
+func hasGrantType(client models.Client, grantType string) bool {
+	for _, gt := range client.GrantTypes {
+		if gt == grantType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashValue(v string) string {
+	sum := sha256.Sum256([]byte(v))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/dpop"
+	"github.com/ZiganshinDev/medods/internal/metrics"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func (o *OAuth) Discovery() oauth.ProviderMetadata {
+	issuer := strings.TrimSuffix(o.cfg.JWT.Issuer, "/")
+
+	scopes := []string{oauth.ScopeOpenID, oauth.ScopeProfile}
+	for _, c := range o.cfg.OAuth.Clients {
+		for _, s := range c.Scopes {
+			if !containsString(scopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	d := oauth.ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/introspect",
+		RevocationEndpoint:                issuer + "/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/device/code",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{oauth.ResponseTypeCode},
+		GrantTypesSupported:               []string{oauth.GrantAuthorizationCode, oauth.GrantClientCredentials, oauth.GrantDeviceCode, oauth.GrantTokenExchange, oauth.GrantRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{auth.AlgRS256},
+		TokenEndpointAuthMethodsSupported: []string{oauth.AuthMethodNone, oauth.AuthMethodBasic, oauth.AuthMethodPost, oauth.AuthMethodTLSClient},
+		CodeChallengeMethodsSupported:     []string{oauth.ChallengeS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "preferred_username"},
+
+		TLSClientCertificateBoundAccessTokens: o.cfg.HTTPServer.TLS.Enabled && o.cfg.HTTPServer.TLS.ClientCAFile != "",
+	}
+
+	if o.cfg.DPoP.Enabled {
+		d.DPoPSigningAlgValuesSupported = dpop.SigningAlgs
+	}
+
+	return d
+}
+
+func (o *OAuth) JWKS() auth.JWKS {
+	return o.tokenManager.JWKS()
+}
+
+// UserInfo returns the claims about the user an access token was issued for.
+// Only tokens granted the openid scope are accepted. The token has been
+// verified with VerifyAccessToken, so revoked tokens and locked users are
+// already refused.
+func (o *OAuth) UserInfo(ctx context.Context, claims *auth.CustomClaims) (oauth.UserInfo, error) {
+	const op = "service.OAuth.UserInfo"
+
+	if !oauth.HasScope(claims.Scope, oauth.ScopeOpenID) {
+		return oauth.UserInfo{}, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInsufficientScope, ""))
+	}
+
+	info := oauth.UserInfo{Subject: claims.Subject}
+	if oauth.HasScope(claims.Scope, oauth.ScopeProfile) {
+		info.PreferredUsername = claims.Subject
+	}
+
+	return info, nil
+}
+
+func (o *OAuth) newIDToken(userName string, clientID string, nonce string, authTime time.Time, accessToken string) (string, error) {
+	const op = "service.OAuth.newIDToken"
+
+	now := time.Now()
+
+	idToken, err := o.tokenManager.NewIDToken(auth.IDTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    strings.TrimSuffix(o.cfg.JWT.Issuer, "/"),
+			Subject:   userName,
+			Audience:  clientID,
+			ExpiresAt: now.Add(o.cfg.JWT.IDTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Nonce:    nonce,
+		AuthTime: authTime.Unix(),
+		AtHash:   auth.AccessTokenHash(accessToken),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	o.service.metrics.TokenIssued(metrics.TokenID)
+
+	return idToken, nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrInvalidRole  = errors.New("invalid role")
+)
+
+type RoleStorage interface {
+	SaveRole(ctx context.Context, role models.Role) error
+	GetRole(ctx context.Context, name string) (models.Role, error)
+	GetRoles(ctx context.Context, names []string) ([]models.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	GetUserRoles(ctx context.Context, userName string) ([]string, error)
+	AssignRole(ctx context.Context, userName string, role string) error
+	UnassignRole(ctx context.Context, userName string, role string) error
+}
+
+type RBAC struct {
+	storage RoleStorage
+}
+
+func NewRBAC(storage RoleStorage) (*RBAC, error) {
+	return &RBAC{storage: storage}, nil
+}
+
+// Bootstrap saves the roles and assignments from the config on startup, in
+// the tenant of ctx. Roles created through the admin API are left alone.
+func (r *RBAC) Bootstrap(ctx context.Context, cfg config.RBAC) error {
+	const op = "service.RBAC.Bootstrap"
+
+	for _, role := range cfg.Roles {
+		if err := r.SaveRole(ctx, models.Role{Name: role.Name, Permissions: role.Permissions}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	for userName, roles := range cfg.Assignments {
+		for _, role := range roles {
+			if err := r.AssignRole(ctx, userName, role); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *RBAC) Roles(ctx context.Context) ([]models.Role, error) {
+	const op = "service.RBAC.Roles"
+
+	roles, err := r.storage.GetRoles(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (r *RBAC) SaveRole(ctx context.Context, role models.Role) error {
+	const op = "service.RBAC.SaveRole"
+
+	if role.Name == "" {
+		return fmt.Errorf("%s: %w: name is required", op, ErrInvalidRole)
+	}
+
+	for _, p := range role.Permissions {
+		if p == "" {
+			return fmt.Errorf("%s: %w: empty permission", op, ErrInvalidRole)
+		}
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	role.UpdatedTime = time.Now()
+
+	if err := r.storage.SaveRole(ctx, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RBAC) DeleteRole(ctx context.Context, name string) error {
+	const op = "service.RBAC.DeleteRole"
+
+	err := r.storage.DeleteRole(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RBAC) UserRoles(ctx context.Context, userName string) ([]string, error) {
+	const op = "service.RBAC.UserRoles"
+
+	roles, err := r.storage.GetUserRoles(ctx, userName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// AssignRole assigns a role to a client, named with ClientSubject. Users sign
+// in through /auth under any name, so their tokens carry no roles and
+// assigning them one is refused.
+func (r *RBAC) AssignRole(ctx context.Context, userName string, role string) error {
+	const op = "service.RBAC.AssignRole"
+
+	if userName == "" {
+		return fmt.Errorf("%s: %w: user name is required", op, ErrInvalidRole)
+	}
+
+	if !strings.HasPrefix(userName, "client:") {
+		return fmt.Errorf("%s: %w: roles are only assigned to \"client:<id>\"", op, ErrInvalidRole)
+	}
+
+	_, err := r.storage.GetRole(ctx, role)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.storage.AssignRole(ctx, userName, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RBAC) UnassignRole(ctx context.Context, userName string, role string) error {
+	const op = "service.RBAC.UnassignRole"
+
+	err := r.storage.UnassignRole(ctx, userName, role)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Claims is a ClaimsEnricher that embeds the subject's roles and the union of
+// their permissions. Changes to roles apply to tokens issued afterwards.
+func (r *RBAC) Claims(ctx context.Context, subject string) ([]auth.ClaimsOption, error) {
+	const op = "service.RBAC.Claims"
+
+	names, err := r.storage.GetUserRoles(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	roles, err := r.storage.GetRoles(ctx, names)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return []auth.ClaimsOption{
+		auth.WithRoles(roleNames(roles)...),
+		auth.WithPermissions(permissions(roles)...),
+	}, nil
+}
+
+func roleNames(roles []models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	return names
+}
+
+func permissions(roles []models.Role) []string {
+	seen := make(map[string]struct{})
+	perms := []string{}
+
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if _, ok := seen[p]; ok {
+				continue
+			}
+
+			seen[p] = struct{}{}
+			perms = append(perms, p)
+		}
+	}
+
+	sort.Strings(perms)
+
+	return perms
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/storage"
+)
+
+// Revoke invalidates a token issued to the calling client. Unknown, expired
+// and already revoked tokens are not an error, as RFC 7009 section 2.2 requires.
+func (o *OAuth) Revoke(ctx context.Context, creds oauth.ClientCredentials, token string, hint string) error {
+	const op = "service.OAuth.Revoke"
+
+	client, err := o.AuthenticateClient(ctx, creds)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if token == "" {
+		return fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+	}
+
+	revokers := []func(context.Context, models.Client, string) (bool, error){
+		o.revokeAccessToken,
+		o.revokeRefreshToken,
+	}
+	if hint == oauth.TokenTypeRefresh {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		found, err := revoke(ctx, client, token)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if found {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (o *OAuth) revokeAccessToken(ctx context.Context, client models.Client, token string) (bool, error) {
+	const op = "service.OAuth.revokeAccessToken"
+
+	claims, err := o.service.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return false, nil
+	}
+
+	if claims.ClientID != client.ID {
+		return true, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, "token was issued to another client"))
+	}
+
+	if err := o.service.RevokeAccessToken(ctx, claims); err != nil {
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+func (o *OAuth) revokeRefreshToken(ctx context.Context, client models.Client, token string) (bool, error) {
+	const op = "service.OAuth.revokeRefreshToken"
+
+	user, err := o.service.LookupRefreshToken(ctx, token)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.ClientID != client.ID {
+		return true, fmt.Errorf("%s: %w", op, oauth.NewError(oauth.ErrUnauthorizedClient, "token was issued to another client"))
+	}
+
+	if err := o.service.RevokeRefreshToken(ctx, user); err != nil {
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
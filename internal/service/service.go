@@ -2,40 +2,198 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
 	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/metrics"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/ZiganshinDev/medods/internal/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
 )
 
+var (
+	ErrTokenRevoked   = errors.New("token revoked")
+	ErrTenantMismatch = errors.New("token belongs to another tenant")
+	ErrDPoPMismatch   = errors.New("refresh token is bound to another DPoP key")
+	ErrTokenReused    = errors.New("refresh token has already been used")
+)
+
+// Storage queries are scoped to the tenant in ctx, if there is one.
 type Storage interface {
-	InsertToken(ctx context.Context, userName string, refreshToken string, timeNow time.Time) error
+	InsertToken(ctx context.Context, user models.Users) error
 	DeleteToken(ctx context.Context, refreshToken string) error
 	DeleteTokensByUser(ctx context.Context, userName string) error
-	SwitchToken(ctx context.Context, oldRefreshToken string, newRefreshToken string, userName string, timeNow time.Time) error
-	CountTokens(ctx context.Context, userName string) (int64, error)
-	GetCreatedTime(ctx context.Context, refreshToken string, userName string) (time.Time, error)
-	GetTokenByUser(ctx context.Context, userName string) (string, error)
+	DeleteTokensByClient(ctx context.Context, userName string, clientID string) error
+	SwitchToken(ctx context.Context, oldID primitive.ObjectID, user models.Users) error
+	GetSessionByUser(ctx context.Context, userName string) (models.Users, error)
+	GetByTokenID(ctx context.Context, tokenID string) (models.Users, error)
+	InsertRotatedToken(ctx context.Context, token models.RotatedToken) error
+	GetRotatedToken(ctx context.Context, tokenID string) (models.RotatedToken, error)
+	ListTokensByUser(ctx context.Context, userName string) ([]models.Users, error)
+	DeleteTokenByID(ctx context.Context, userName string, id string) error
 }
 
 type TokenManager interface {
-	NewJWT(userId string, ttl time.Duration) (string, error)
+	NewJWT(userId string, ttl time.Duration, opts ...auth.ClaimsOption) (string, error)
+	ParseJWT(accessToken string) (*auth.CustomClaims, error)
+	ParseIssuedJWT(accessToken string) (*auth.CustomClaims, error)
 	NewRefreshToken() (string, error)
+	NewCode() (string, error)
+	NewIDToken(claims auth.IDTokenClaims) (string, error)
+	JWKS() auth.JWKS
 	HashToken(token string) ([]byte, error)
 	CompareTokens(providedToken string, hashedToken []byte) bool
+	RotateKey(key auth.Key)
+	IDTokenKeys() []auth.Key
+	SetIDTokenKeys(keys ...auth.Key)
+}
+
+type Denylist interface {
+	Deny(ctx context.Context, jti string, expiresAt time.Time) error
+	IsDenied(ctx context.Context, jti string) (bool, error)
 }
 
+// ClaimsEnricher adds claims to a client's access token before it is signed.
+type ClaimsEnricher func(ctx context.Context, subject string) ([]auth.ClaimsOption, error)
+
 type Service struct {
 	cfg          *config.Config
 	storage      Storage
 	tokenManager TokenManager
+	denylist     Denylist
+	locks        UserLocks
+	enrichers    []ClaimsEnricher
+	tokenIDKey   []byte
+	metrics      *metrics.Metrics
+	auditor      *audit.Auditor
+	events       *EventBus
 }
 
-func New(cfg *config.Config, storage Storage, tokenManager TokenManager) (*Service, error) {
+func New(cfg *config.Config, storage Storage, tokenManager TokenManager, denylist Denylist, locks UserLocks) (*Service, error) {
 	return &Service{
 		cfg:          cfg,
 		storage:      storage,
-		tokenManager: tokenManager}, nil
+		tokenManager: tokenManager,
+		denylist:     denylist,
+		locks:        locks,
+		tokenIDKey:   tokenIDKey(cfg.JWT.SigningKey)}, nil
+}
+
+func (s *Service) AddClaimsEnricher(e ClaimsEnricher) {
+	s.enrichers = append(s.enrichers, e)
+}
+
+// SetMetrics makes the service record token metrics to m.
+func (s *Service) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// SetAuditor makes the service record authentication events to a.
+func (s *Service) SetAuditor(a *audit.Auditor) {
+	s.auditor = a
+}
+
+// SetEventBus makes the service publish its events to bus.
+func (s *Service) SetEventBus(bus *EventBus) {
+	s.events = bus
+}
+
+// NewAccessToken signs an access token for subject. The configured issuer and
+// audience come first, then opts, so callers have the last word. Only the tid
+// claim of the tenant in ctx, and the cnf claim of the key the client proved
+// in ctx, cannot be changed.
+//
+// The enrichers are not called: user names reach here from /auth, which does
+// not check credentials, so they must not carry roles or permissions.
+func (s *Service) NewAccessToken(ctx context.Context, subject string, ttl time.Duration, opts ...auth.ClaimsOption) (string, error) {
+	const op = "service.NewAccessToken"
+
+	accessToken, err := s.newAccessToken(ctx, subject, ttl, opts...)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, nil
+}
+
+// NewClientAccessToken signs an access token for an authenticated client
+// acting on its own behalf. The enrichers look the client up as
+// ClientSubject(clientID), and their claims come before opts.
+func (s *Service) NewClientAccessToken(ctx context.Context, clientID string, ttl time.Duration, opts ...auth.ClaimsOption) (string, error) {
+	const op = "service.NewClientAccessToken"
+
+	var claims []auth.ClaimsOption
+	for _, enrich := range s.enrichers {
+		extra, err := enrich(ctx, ClientSubject(clientID))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		claims = append(claims, extra...)
+	}
+
+	claims = append(claims, opts...)
+	claims = append(claims, auth.WithClientID(clientID))
+
+	accessToken, err := s.newAccessToken(ctx, clientID, ttl, claims...)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, nil
+}
+
+// ClientSubject is the name a client has for the enrichers, such as RBAC
+// role assignments. It never collides with a user name.
+func ClientSubject(clientID string) string {
+	return "client:" + clientID
+}
+
+func (s *Service) newAccessToken(ctx context.Context, subject string, ttl time.Duration, opts ...auth.ClaimsOption) (string, error) {
+	ctx, span := tracing.Start(ctx, "service.newAccessToken")
+	defer span.End()
+
+	claims := []auth.ClaimsOption{auth.WithIssuer(s.cfg.JWT.Issuer)}
+	if s.cfg.JWT.Audience != "" {
+		claims = append(claims, auth.WithAudience(s.cfg.JWT.Audience))
+	}
+
+	claims = append(claims, opts...)
+	claims = append(claims, auth.WithTenant(tenant.ID(ctx)))
+
+	cnf, _ := auth.ConfirmationFromContext(ctx)
+	claims = append(claims, auth.WithConfirmation(cnf))
+
+	accessToken, err := s.tokenManager.NewJWT(subject, ttl, claims...)
+	if err != nil {
+		return "", err
+	}
+
+	s.metrics.TokenIssued(metrics.TokenAccess)
+
+	return accessToken, nil
+}
+
+// AccessTokenTTL is the access token lifetime of the tenant in ctx.
+func (s *Service) AccessTokenTTL(ctx context.Context) time.Duration {
+	return tenant.AccessTokenTTL(ctx, s.cfg.JWT.AccessTokenTTL)
+}
+
+// RefreshTokenTTL is the refresh token lifetime of the tenant in ctx.
+func (s *Service) RefreshTokenTTL(ctx context.Context) time.Duration {
+	return tenant.RefreshTokenTTL(ctx, s.cfg.JWT.RefreshTokenTTL)
 }
 
 func (s *Service) GetRefreshToken(userName string) (string, error) {
@@ -49,10 +207,18 @@ func (s *Service) GetRefreshToken(userName string) (string, error) {
 	return refreshToken, nil
 }
 
-func (s *Service) GetAccessToken(userName string) (string, error) {
+func (s *Service) GetAccessToken(ctx context.Context, userName string) (string, error) {
 	const op = "service.GetAccessToken"
 
-	accessToken, err := s.tokenManager.NewJWT(userName, s.cfg.AccessTokenTTL)
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	session, err := s.storage.GetSessionByUser(ctx, userName)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, err := s.NewAccessToken(ctx, userName, s.AccessTokenTTL(ctx), auth.WithAuthTime(session.AuthTime))
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -60,101 +226,397 @@ func (s *Service) GetAccessToken(userName string) (string, error) {
 	return accessToken, nil
 }
 
-func (s *Service) ValidToken(tokenFromHeader string, userName string) bool {
-	tokenFromDB, err := s.getTokenFromDB(userName)
+func (s *Service) VerifyAccessToken(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+	return s.verifyAccessToken(ctx, accessToken, s.tokenManager.ParseJWT)
+}
+
+// verifyIssuedToken is VerifyAccessToken for a token of any audience.
+func (s *Service) verifyIssuedToken(ctx context.Context, accessToken string) (*auth.CustomClaims, error) {
+	return s.verifyAccessToken(ctx, accessToken, s.tokenManager.ParseIssuedJWT)
+}
+
+func (s *Service) verifyAccessToken(ctx context.Context, accessToken string, parse func(string) (*auth.CustomClaims, error)) (*auth.CustomClaims, error) {
+	const op = "service.VerifyAccessToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	claims, err := parse(accessToken)
 	if err != nil {
+		s.rejectAccessToken(ctx, "", "invalid")
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if t, ok := tenant.FromContext(ctx); ok && claims.TenantID != t.ID {
+		s.rejectAccessToken(ctx, claims.Subject, "tenant_mismatch")
+		return nil, fmt.Errorf("%s: %w", op, ErrTenantMismatch)
+	}
+
+	if err := s.CheckUserActive(ctx, claims.Subject); err != nil {
+		if errors.Is(err, ErrUserLocked) {
+			s.rejectAccessToken(ctx, claims.Subject, "user_locked")
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if claims.Id != "" {
+		denied, err := s.denylist.IsDenied(ctx, claims.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if denied {
+			s.rejectAccessToken(ctx, claims.Subject, "revoked")
+			return nil, fmt.Errorf("%s: %w", op, ErrTokenRevoked)
+		}
+	}
+
+	return claims, nil
+}
+
+func (s *Service) rejectAccessToken(ctx context.Context, subject string, reason string) {
+	s.metrics.ValidationFailed(reason)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.ValidationFailed, Outcome: audit.Failure, Subject: subject, Reason: reason})
+}
+
+// RevokeAccessToken denies the token's jti until the token would have expired anyway.
+func (s *Service) RevokeAccessToken(ctx context.Context, claims *auth.CustomClaims) error {
+	const op = "service.RevokeAccessToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if claims.Id == "" {
+		return fmt.Errorf("%s: %w", op, errors.New("token has no jti"))
+	}
+
+	if err := s.denylist.Deny(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.metrics.Revoked(metrics.TokenAccess)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Revoke, Subject: claims.Subject, ClientID: claims.ClientID, Reason: "access_token"})
+
+	return nil
+}
+
+func (s *Service) RevokeRefreshToken(ctx context.Context, user models.Users) error {
+	const op = "service.RevokeRefreshToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := s.storage.DeleteToken(ctx, user.RefreshToken); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.metrics.Revoked(metrics.TokenRefresh)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Revoke, Subject: user.Name, SessionID: user.ID.Hex(), ClientID: user.ClientID, Reason: "refresh_token"})
+	s.events.Publish(ctx, Event{Type: EventSessionRevoked, Subject: user.Name, SessionID: user.ID.Hex(), ClientID: user.ClientID, Reason: "refresh_token"})
+
+	return nil
+}
+
+// ValidToken reports whether refreshToken is the current token of one of
+// userName's first-party sessions, and may be rotated by SwitchToken.
+func (s *Service) ValidToken(ctx context.Context, refreshToken string, userName string) bool {
+	ctx, span := tracing.Start(ctx, "service.ValidToken")
+	defer span.End()
+
+	user, err := s.storage.GetByTokenID(ctx, s.tokenID(refreshToken))
+	if errors.Is(err, storage.ErrNotFound) && s.detectReuse(ctx, refreshToken) {
+		s.rejectRefresh(ctx, userName, "refresh_reused", nil)
+		return false
+	}
+	if err != nil {
+		s.rejectRefresh(ctx, userName, "refresh_not_found", err)
+		return false
+	}
+
+	if user.Name != userName || !s.compareTokens(ctx, refreshToken, []byte(user.RefreshToken)) {
+		s.rejectRefresh(ctx, userName, "refresh_mismatch", nil)
 		return false
 	}
 
-	if ok := s.tokenManager.CompareTokens(tokenFromHeader, []byte(tokenFromDB)); !ok {
+	// Sessions of OAuth clients are refreshed with their grant at the token
+	// endpoint, so that they keep their client and scope.
+	if user.ClientID != "" {
+		s.rejectRefresh(ctx, userName, "refresh_client_session", nil)
 		return false
 	}
 
-	if ok, err := s.checkTokenTtl(tokenFromDB, userName, time.Now()); err != nil || !ok {
+	if user.CreatedTime.Add(s.RefreshTokenTTL(ctx)).Before(time.Now()) {
+		err := s.storage.DeleteTokenByID(ctx, user.Name, user.ID.Hex())
+		s.rejectRefresh(ctx, userName, "refresh_expired", err)
+		return false
+	}
+
+	if err := checkSessionKey(ctx, user); err != nil {
+		s.rejectRefresh(ctx, userName, "dpop_mismatch", err)
 		return false
 	}
 
 	return true
 }
 
-func (s *Service) CheckCountTokensByUser(userName string) error {
-	const op = "service.CheckCountTokensByUser"
+// checkSessionKey makes sure a session started with a DPoP proof is only
+// refreshed with a proof of the same key (RFC 9449 section 5).
+func checkSessionKey(ctx context.Context, user models.Users) error {
+	if user.JKT == "" {
+		return nil
+	}
+
+	if cnf, _ := auth.ConfirmationFromContext(ctx); cnf.JKT != user.JKT {
+		return ErrDPoPMismatch
+	}
+
+	return nil
+}
+
+// tokenType is the token_type of tokens issued within ctx.
+func tokenType(ctx context.Context) string {
+	if cnf, _ := auth.ConfirmationFromContext(ctx); cnf.JKT != "" {
+		return "DPoP"
+	}
 
-	count, err := s.storage.CountTokens(context.TODO(), userName)
+	return "Bearer"
+}
+
+// rejectRefresh records why ValidToken turned a refresh token down, since
+// callers only learn that it did.
+func (s *Service) rejectRefresh(ctx context.Context, userName string, reason string, err error) {
+	s.metrics.ValidationFailed(reason)
+	s.metrics.Refreshed(false)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Refresh, Outcome: audit.Failure, Subject: userName, Reason: reason})
+
+	log := logctx.FromContext(ctx).With(slog.String("user", userName), slog.String("reason", reason))
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		log = log.With(sl.Err(err))
 	}
 
-	if count > 0 {
-		if err := s.storage.DeleteTokensByUser(context.TODO(), userName); err != nil {
-			return fmt.Errorf("%s: %w", op, err)
-		}
+	log.Debug("refresh token rejected")
+}
+
+// CheckCountTokensByUser ends the user's first-party session before /auth
+// starts a new one. Sessions of OAuth clients are left alone.
+func (s *Service) CheckCountTokensByUser(ctx context.Context, userName string) error {
+	const op = "service.CheckCountTokensByUser"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := s.storage.DeleteTokensByClient(ctx, userName, ""); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Service) InsertToken(refreshToken string, userName string) error {
+func (s *Service) InsertToken(ctx context.Context, refreshToken string, userName string) error {
 	const op = "service.InsertToken"
 
-	hashedToken, err := s.tokenManager.HashToken(refreshToken)
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := s.InsertGrantToken(ctx, refreshToken, userName, "", "", time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// InsertGrantToken stores a refresh token issued to an OAuth client together
+// with the scope that was granted and when the user authenticated.
+func (s *Service) InsertGrantToken(ctx context.Context, refreshToken string, userName string, clientID string, scope string, authTime time.Time) error {
+	const op = "service.InsertGrantToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	user, err := s.newSession(ctx, refreshToken, userName)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.storage.InsertToken(context.TODO(), userName, string(hashedToken), time.Now()); err != nil {
+	user.ClientID = clientID
+	user.Scope = scope
+	user.AuthTime = authTime
+
+	if err := s.storage.InsertToken(ctx, user); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	s.metrics.TokenIssued(metrics.TokenRefresh)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Login, Subject: userName, SessionID: user.ID.Hex(), ClientID: clientID})
+	s.events.Publish(ctx, Event{Type: EventUserLoggedIn, Subject: userName, SessionID: user.ID.Hex(), ClientID: clientID})
+
 	return nil
 }
 
-func (s *Service) SwitchToken(newToken string, userName string) error {
-	const op = "service.switchToken"
+// LookupRefreshToken finds the session a refresh token belongs to. The token
+// must still match the stored bcrypt hash and be within its TTL.
+func (s *Service) LookupRefreshToken(ctx context.Context, refreshToken string) (models.Users, error) {
+	const op = "service.LookupRefreshToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
-	oldToken, err := s.getTokenFromDB(userName)
+	user, err := s.storage.GetByTokenID(ctx, s.tokenID(refreshToken))
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !s.compareTokens(ctx, refreshToken, []byte(user.RefreshToken)) {
+		return models.Users{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	if user.CreatedTime.Add(s.RefreshTokenTTL(ctx)).Before(time.Now()) {
+		return models.Users{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
 	}
 
-	hashedToken, err := s.tokenManager.HashToken(newToken)
+	return user, nil
+}
+
+func (s *Service) newSession(ctx context.Context, refreshToken string, userName string) (models.Users, error) {
+	const op = "service.newSession"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	_, hashSpan := tracing.Start(ctx, "bcrypt.Hash")
+	start := time.Now()
+	hashedToken, err := s.tokenManager.HashToken(refreshToken)
+	s.metrics.ObserveHash("hash", start)
+	hashSpan.End()
 	if err != nil {
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cnf, _ := auth.ConfirmationFromContext(ctx)
+
+	return models.Users{
+		ID:           primitive.NewObjectID(),
+		Name:         userName,
+		RefreshToken: string(hashedToken),
+		TokenID:      s.tokenID(refreshToken),
+		TenantID:     tenant.ID(ctx),
+		JKT:          cnf.JKT,
+		CreatedTime:  time.Now(),
+	}, nil
+}
+
+// SwitchToken replaces the session of oldToken with one of newToken.
+func (s *Service) SwitchToken(ctx context.Context, oldToken string, newToken string) error {
+	const op = "service.switchToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	// ValidToken has found the session, so it can only be gone because a
+	// concurrent request rotated it.
+	old, err := s.storage.GetByTokenID(ctx, s.tokenID(oldToken))
+	if errors.Is(err, storage.ErrNotFound) {
+		s.metrics.Refreshed(false)
+		return fmt.Errorf("%s: %w", op, ErrTokenReused)
+	}
+	if err != nil {
+		s.metrics.Refreshed(false)
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.storage.SwitchToken(context.TODO(), oldToken, string(hashedToken), userName, time.Now()); err != nil {
+	if _, err := s.rotateSession(ctx, old, newToken); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Service) getTokenFromDB(userName string) (string, error) {
-	const op = "service.getTokenFromDB"
+// rotateSession replaces old with a session of newToken. Of two rotations of
+// the same session only one succeeds; the other fails with ErrTokenReused.
+func (s *Service) rotateSession(ctx context.Context, old models.Users, newToken string) (models.Users, error) {
+	const op = "service.rotateSession"
 
-	refreshTokenFromDB, err := s.storage.GetTokenByUser(context.Background(), userName)
+	user, err := s.newSession(ctx, newToken, old.Name)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		s.metrics.Refreshed(false)
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return refreshTokenFromDB, nil
-}
-
-func (s *Service) checkTokenTtl(tokenFromDB string, userName string, time time.Time) (bool, error) {
-	const op = "service.checkTokenTtl"
+	// Refreshing is not authenticating again, nor a new grant.
+	user.ClientID = old.ClientID
+	user.Scope = old.Scope
+	user.AuthTime = old.AuthTime
 
-	createdTime, err := s.storage.GetCreatedTime(context.TODO(), tokenFromDB, userName)
+	err = s.storage.SwitchToken(ctx, old.ID, user)
+	if errors.Is(err, storage.ErrConflict) {
+		s.rejectRefresh(ctx, old.Name, "refresh_reused", nil)
+		s.events.Publish(ctx, Event{Type: EventTokenReuseDetected, Subject: old.Name, SessionID: old.ID.Hex(), ClientID: old.ClientID, Reason: "refresh_reused"})
+		return models.Users{}, fmt.Errorf("%s: %w", op, ErrTokenReused)
+	}
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		s.metrics.Refreshed(false)
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if createdTime.Add(s.cfg.JWT.RefreshTokenTTL).Before(time) {
-		if err := s.storage.DeleteToken(context.TODO(), tokenFromDB); err != nil {
-			return false, fmt.Errorf("%s: %w", op, err)
-		}
+	rotated := models.RotatedToken{
+		TokenID:   old.TokenID,
+		Name:      old.Name,
+		TenantID:  old.TenantID,
+		ClientID:  old.ClientID,
+		SessionID: user.ID.Hex(),
+		ExpiresAt: old.CreatedTime.Add(s.RefreshTokenTTL(ctx)),
+	}
+
+	if err := s.storage.InsertRotatedToken(ctx, rotated); err != nil {
+		logctx.FromContext(ctx).Warn("failed to record rotated refresh token", slog.String("session", old.ID.Hex()), sl.Err(err))
+	}
 
-		return false, nil
+	s.metrics.Refreshed(true)
+	s.metrics.TokenIssued(metrics.TokenRefresh)
+	s.auditor.Record(ctx, models.AuditEvent{Type: audit.Refresh, Subject: user.Name, SessionID: user.ID.Hex(), ClientID: user.ClientID})
+
+	return user, nil
+}
+
+// detectReuse reports whether refreshToken is one that has been rotated, and
+// if so publishes EventTokenReuseDetected for the user it was issued to.
+// Unknown tokens are not reported: anyone can make those up.
+func (s *Service) detectReuse(ctx context.Context, refreshToken string) bool {
+	rotated, err := s.storage.GetRotatedToken(ctx, s.tokenID(refreshToken))
+	if err != nil {
+		return false
 	}
 
-	return true, nil
+	s.events.Publish(ctx, Event{Type: EventTokenReuseDetected, Subject: rotated.Name, SessionID: rotated.SessionID, ClientID: rotated.ClientID, Reason: "refresh_reused"})
+
+	return true
+}
+
+// compareTokens checks a token against its bcrypt hash.
+func (s *Service) compareTokens(ctx context.Context, token string, hashedToken []byte) bool {
+	_, span := tracing.Start(ctx, "bcrypt.Compare")
+	defer span.End()
+
+	defer s.metrics.ObserveHash("compare", time.Now())
+
+	return s.tokenManager.CompareTokens(token, hashedToken)
+}
+
+// tokenID is a lookup key for a refresh token. Unlike the bcrypt hash it is
+// deterministic, so a session can be found from the token alone. It is an
+// HMAC, so the stored value is of no use without the server's key.
+func (s *Service) tokenID(refreshToken string) string {
+	mac := hmac.New(sha256.New, s.tokenIDKey)
+	mac.Write([]byte(refreshToken))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// tokenIDKey derives the tokenID key from the signing key, so that neither
+// value can stand in for the other.
+func tokenIDKey(signingKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte("refresh token id"))
+
+	return mac.Sum(nil)
 }
@@ -0,0 +1,688 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/audit"
+	"github.com/ZiganshinDev/medods/internal/auth"
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/oauth"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sessionStore is an in-memory Storage.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions []models.Users
+	rotated  []models.RotatedToken
+}
+
+func (s *sessionStore) InsertToken(_ context.Context, user models.Users) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, user)
+	return nil
+}
+
+func (s *sessionStore) DeleteToken(_ context.Context, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(func(u models.Users) bool { return u.RefreshToken == refreshToken })
+	return nil
+}
+
+func (s *sessionStore) DeleteTokensByUser(_ context.Context, userName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(func(u models.Users) bool { return u.Name == userName })
+	return nil
+}
+
+func (s *sessionStore) DeleteTokensByClient(_ context.Context, userName string, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(func(u models.Users) bool { return u.Name == userName && u.ClientID == clientID })
+	return nil
+}
+
+func (s *sessionStore) SwitchToken(_ context.Context, oldID primitive.ObjectID, user models.Users) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.sessions)
+	s.remove(func(u models.Users) bool { return u.ID == oldID })
+	if len(s.sessions) != n-1 {
+		return storage.ErrConflict
+	}
+
+	s.sessions = append(s.sessions, user)
+	return nil
+}
+
+func (s *sessionStore) GetSessionByUser(_ context.Context, userName string) (models.Users, error) {
+	return s.find(func(u models.Users) bool { return u.Name == userName && u.ClientID == "" })
+}
+
+func (s *sessionStore) GetByTokenID(_ context.Context, tokenID string) (models.Users, error) {
+	return s.find(func(u models.Users) bool { return u.TokenID == tokenID })
+}
+
+func (s *sessionStore) InsertRotatedToken(_ context.Context, token models.RotatedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotated = append(s.rotated, token)
+	return nil
+}
+
+func (s *sessionStore) GetRotatedToken(_ context.Context, tokenID string) (models.RotatedToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.rotated {
+		if t.TokenID == tokenID {
+			return t, nil
+		}
+	}
+
+	return models.RotatedToken{}, storage.ErrNotFound
+}
+
+func (s *sessionStore) ListTokensByUser(_ context.Context, userName string) ([]models.Users, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []models.Users{}
+	for _, u := range s.sessions {
+		if u.Name == userName {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *sessionStore) DeleteTokenByID(_ context.Context, userName string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(func(u models.Users) bool { return u.Name == userName && u.ID.Hex() == id })
+	return nil
+}
+
+func (s *sessionStore) find(match func(models.Users) bool) (models.Users, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.sessions {
+		if match(u) {
+			return u, nil
+		}
+	}
+
+	return models.Users{}, storage.ErrNotFound
+}
+
+func (s *sessionStore) remove(match func(models.Users) bool) {
+	kept := s.sessions[:0]
+	for _, u := range s.sessions {
+		if !match(u) {
+			kept = append(kept, u)
+		}
+	}
+
+	s.sessions = kept
+}
+
+type denylist map[string]bool
+
+func (d denylist) Deny(_ context.Context, jti string, _ time.Time) error {
+	d[jti] = true
+	return nil
+}
+
+func (d denylist) IsDenied(_ context.Context, jti string) (bool, error) {
+	return d[jti], nil
+}
+
+type noLocks struct{}
+
+func (noLocks) Lock(context.Context, models.UserLock) error { return nil }
+func (noLocks) Unlock(context.Context, string) error        { return nil }
+func (noLocks) GetLock(context.Context, string) (models.UserLock, error) {
+	return models.UserLock{}, storage.ErrNotFound
+}
+
+type clientStore map[string]models.Client
+
+func (c clientStore) GetClient(_ context.Context, clientID string) (models.Client, error) {
+	client, ok := c[clientID]
+	if !ok {
+		return models.Client{}, storage.ErrNotFound
+	}
+
+	return client, nil
+}
+
+func (c clientStore) SaveClient(_ context.Context, client models.Client) error {
+	c[client.ID] = client
+	return nil
+}
+
+const testSecret = "secret"
+
+func newTestService(t *testing.T) (*Service, *OAuth, *sessionStore) {
+	t.Helper()
+
+	cfg := &config.Config{
+		Env: "local",
+		JWT: config.JWT{
+			AccessTokenTTL:  time.Minute,
+			RefreshTokenTTL: time.Hour,
+			Issuer:          "https://auth.example.com",
+			SigningKey:      "key",
+		},
+	}
+
+	tokenManager, err := auth.New(cfg.JWT.SigningKey)
+	require.NoError(t, err)
+	tokenManager.Expect(cfg.JWT.Issuer, cfg.JWT.Audience)
+
+	secretHash, err := tokenManager.HashToken(testSecret)
+	require.NoError(t, err)
+
+	store := &sessionStore{}
+
+	s, err := New(cfg, store, tokenManager, denylist{}, noLocks{})
+	require.NoError(t, err)
+
+	clients := clientStore{
+		"billing": {ID: "billing", SecretHash: string(secretHash)},
+		"web":     {ID: "web"},
+		"gateway": {
+			ID:            "gateway",
+			SecretHash:    string(secretHash),
+			Scopes:        []string{"profile"},
+			GrantTypes:    []string{oauth.GrantTokenExchange},
+			TokenExchange: models.TokenExchangePolicy{Impersonation: true, Audiences: []string{"billing"}},
+		},
+	}
+
+	o, err := NewOAuth(cfg, clients, nil, nil, tokenManager, s)
+	require.NoError(t, err)
+
+	return s, o, store
+}
+
+func TestIntrospect(t *testing.T) {
+	ctx := context.Background()
+	s, o, store := newTestService(t)
+
+	creds := oauth.ClientCredentials{ID: "billing", Secret: testSecret, Method: oauth.AuthMethodBasic}
+
+	refreshToken, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	require.NoError(t, s.InsertGrantToken(ctx, refreshToken, "alice", "web", "profile", time.Now()))
+
+	// The lookup key must not be derivable from the token alone.
+	require.NotEqual(t, hashValue(refreshToken), store.sessions[0].TokenID)
+
+	resp, err := o.Introspect(ctx, creds, refreshToken, oauth.TokenTypeRefresh)
+	require.NoError(t, err)
+	require.True(t, resp.Active)
+	require.Equal(t, "alice", resp.Subject)
+	require.Equal(t, "web", resp.ClientID)
+	require.Equal(t, "profile", resp.Scope)
+
+	// A client's session is not refreshed at /refresh, which would drop its
+	// client and scope, but with its grant, which keeps them.
+	require.False(t, s.ValidToken(ctx, refreshToken, "alice"))
+
+	web := oauth.ClientCredentials{ID: "web", Method: oauth.AuthMethodNone}
+
+	_, err = o.Token(ctx, oauth.TokenRequest{GrantType: oauth.GrantRefreshToken, Client: creds, RefreshToken: refreshToken})
+	var oerr *oauth.Error
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, oauth.ErrInvalidGrant, oerr.Code)
+
+	_, err = o.Token(ctx, oauth.TokenRequest{GrantType: oauth.GrantRefreshToken, Client: web, RefreshToken: refreshToken, Scope: "openid"})
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, oauth.ErrInvalidScope, oerr.Code)
+
+	refreshed, err := o.Token(ctx, oauth.TokenRequest{GrantType: oauth.GrantRefreshToken, Client: web, RefreshToken: refreshToken})
+	require.NoError(t, err)
+	require.Equal(t, "profile", refreshed.Scope)
+
+	claims, err := s.VerifyAccessToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "web", claims.ClientID)
+	require.Equal(t, "profile", claims.Scope)
+
+	rotated := refreshed.RefreshToken
+
+	resp, err = o.Introspect(ctx, creds, rotated, "")
+	require.NoError(t, err)
+	require.True(t, resp.Active)
+	require.Equal(t, "web", resp.ClientID)
+	require.Equal(t, "profile", resp.Scope)
+
+	resp, err = o.Introspect(ctx, creds, refreshToken, "")
+	require.NoError(t, err)
+	require.False(t, resp.Active)
+
+	accessToken, err := s.NewAccessToken(ctx, "alice", time.Minute, auth.WithScope("profile"))
+	require.NoError(t, err)
+
+	resp, err = o.Introspect(ctx, creds, accessToken, "")
+	require.NoError(t, err)
+	require.True(t, resp.Active)
+	require.Equal(t, oauth.TokenTypeAccess, resp.TokenType)
+
+	_, err = o.Introspect(ctx, web, accessToken, "")
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, oauth.ErrUnauthorizedClient, oerr.Code)
+}
+
+func TestRefreshTokenRotatesOnce(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestService(t)
+
+	refreshToken, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	require.NoError(t, s.InsertToken(ctx, refreshToken, "alice"))
+
+	require.False(t, s.ValidToken(ctx, refreshToken, "bob"))
+
+	require.True(t, s.ValidToken(ctx, refreshToken, "alice"))
+
+	// Two requests racing with the same token both find its session; only
+	// the first may rotate it.
+	session, err := s.storage.GetByTokenID(ctx, s.tokenID(refreshToken))
+	require.NoError(t, err)
+
+	first, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	second, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+
+	_, err = s.rotateSession(ctx, session, first)
+	require.NoError(t, err)
+	_, err = s.rotateSession(ctx, session, second)
+	require.ErrorIs(t, err, ErrTokenReused)
+
+	require.ErrorIs(t, s.SwitchToken(ctx, refreshToken, second), ErrTokenReused)
+
+	require.False(t, s.ValidToken(ctx, refreshToken, "alice"))
+	require.True(t, s.ValidToken(ctx, first, "alice"))
+	require.False(t, s.ValidToken(ctx, second, "alice"))
+}
+
+func TestRefreshTokenReuseIsDetected(t *testing.T) {
+	ctx := context.Background()
+	s, o, _ := newTestService(t)
+
+	var reused []Event
+	bus := NewEventBus()
+	bus.Subscribe(func(_ context.Context, e Event) { reused = append(reused, e) }, EventTokenReuseDetected)
+	s.SetEventBus(bus)
+
+	refreshToken, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	require.NoError(t, s.InsertToken(ctx, refreshToken, "alice"))
+
+	// A made-up token says nothing about anyone, whatever name comes with it.
+	require.False(t, s.ValidToken(ctx, "garbage", "alice"))
+	require.Empty(t, reused)
+
+	rotated, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	require.True(t, s.ValidToken(ctx, refreshToken, "alice"))
+	require.NoError(t, s.SwitchToken(ctx, refreshToken, rotated))
+	require.Empty(t, reused)
+
+	// The replaced token is known to have been alice's, whoever replays it.
+	require.False(t, s.ValidToken(ctx, refreshToken, "mallory"))
+	require.Len(t, reused, 1)
+	require.Equal(t, "alice", reused[0].Subject)
+
+	granted, err := o.issueTokens(ctx, "bob", "web", "profile", time.Now())
+	require.NoError(t, err)
+
+	web := oauth.ClientCredentials{ID: "web", Method: oauth.AuthMethodNone}
+	_, err = o.Token(ctx, oauth.TokenRequest{GrantType: oauth.GrantRefreshToken, Client: web, RefreshToken: granted.RefreshToken})
+	require.NoError(t, err)
+
+	_, err = o.Token(ctx, oauth.TokenRequest{GrantType: oauth.GrantRefreshToken, Client: web, RefreshToken: granted.RefreshToken})
+	var oerr *oauth.Error
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, oauth.ErrInvalidGrant, oerr.Code)
+	require.Len(t, reused, 2)
+	require.Equal(t, "bob", reused[1].Subject)
+	require.Equal(t, "web", reused[1].ClientID)
+}
+
+func TestGrantsKeepOtherSessions(t *testing.T) {
+	ctx := context.Background()
+	s, o, store := newTestService(t)
+
+	firstParty, err := s.GetRefreshToken("alice")
+	require.NoError(t, err)
+	require.NoError(t, s.InsertToken(ctx, firstParty, "alice"))
+
+	_, err = o.issueTokens(ctx, "alice", "web", "profile", time.Now())
+	require.NoError(t, err)
+	_, err = o.issueTokens(ctx, "alice", "billing", "", time.Now())
+	require.NoError(t, err)
+
+	// A second grant to a client replaces its session only.
+	_, err = o.issueTokens(ctx, "alice", "web", "profile", time.Now())
+	require.NoError(t, err)
+	require.Len(t, store.sessions, 3)
+	require.True(t, s.ValidToken(ctx, firstParty, "alice"))
+
+	// So does signing in at /auth.
+	require.NoError(t, s.CheckCountTokensByUser(ctx, "alice"))
+	require.Len(t, store.sessions, 2)
+	for _, session := range store.sessions {
+		require.NotEmpty(t, session.ClientID)
+	}
+}
+
+// deviceStore is an in-memory DeviceStorage with the same conditional
+// updates as the Mongo one.
+type deviceStore struct {
+	mu    sync.Mutex
+	codes map[string]models.DeviceCode
+}
+
+func (s *deviceStore) InsertDeviceCode(_ context.Context, code models.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[code.DeviceCodeHash] = code
+	return nil
+}
+
+func (s *deviceStore) GetDeviceCode(_ context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[deviceCodeHash]
+	if !ok {
+		return models.DeviceCode{}, storage.ErrNotFound
+	}
+
+	return code, nil
+}
+
+func (s *deviceStore) GetDeviceCodeByUserCode(_ context.Context, userCode string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range s.codes {
+		if code.UserCode == userCode {
+			return code, nil
+		}
+	}
+
+	return models.DeviceCode{}, storage.ErrNotFound
+}
+
+func (s *deviceStore) RecordDevicePoll(_ context.Context, deviceCodeHash string, polledAt time.Time, interval int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[deviceCodeHash]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	code.LastPolledAt = polledAt
+	code.Interval = interval
+	s.codes[deviceCodeHash] = code
+
+	return nil
+}
+
+func (s *deviceStore) DecideDeviceCode(_ context.Context, decided models.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[decided.DeviceCodeHash]
+	if !ok || code.Status != models.DeviceCodePending {
+		return storage.ErrConflict
+	}
+
+	code.Status = decided.Status
+	code.UserName = decided.UserName
+	code.AuthTime = decided.AuthTime
+	s.codes[decided.DeviceCodeHash] = code
+
+	return nil
+}
+
+func (s *deviceStore) TakeApprovedDeviceCode(_ context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[deviceCodeHash]
+	if !ok || code.Status != models.DeviceCodeApproved {
+		return models.DeviceCode{}, storage.ErrNotFound
+	}
+
+	delete(s.codes, deviceCodeHash)
+
+	return code, nil
+}
+
+func TestDeviceApprovalIsNotUndoneByPolling(t *testing.T) {
+	ctx := context.Background()
+	_, o, _ := newTestService(t)
+
+	devices := &deviceStore{codes: map[string]models.DeviceCode{}}
+	o.devices = devices
+
+	pending := models.DeviceCode{
+		DeviceCodeHash: "hash",
+		UserCode:       "BCDF-GHJK",
+		ClientID:       "web",
+		Status:         models.DeviceCodePending,
+		Interval:       5,
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}
+	require.NoError(t, devices.InsertDeviceCode(ctx, pending))
+
+	require.NoError(t, o.ApproveDevice(ctx, "alice", time.Now(), pending.UserCode, true))
+
+	// A poll that read the code before the approval must not revert it.
+	err := o.pollDeviceCode(ctx, pending, time.Now())
+	var oerr *oauth.Error
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, oauth.ErrAuthorizationPending, oerr.Code)
+
+	code, err := devices.GetDeviceCode(ctx, "hash")
+	require.NoError(t, err)
+	require.Equal(t, models.DeviceCodeApproved, code.Status)
+	require.Equal(t, "alice", code.UserName)
+	require.False(t, code.LastPolledAt.IsZero())
+
+	// A decision made while another was in flight is a conflict.
+	err = devices.DecideDeviceCode(ctx, models.DeviceCode{DeviceCodeHash: "hash", Status: models.DeviceCodeDenied})
+	require.ErrorIs(t, err, storage.ErrConflict)
+}
+
+type auditLog []models.AuditEvent
+
+func (l *auditLog) Write(_ context.Context, event models.AuditEvent) error {
+	*l = append(*l, event)
+	return nil
+}
+
+func TestTokenExchangeIsAudited(t *testing.T) {
+	ctx := context.Background()
+	s, o, _ := newTestService(t)
+
+	events := &auditLog{}
+	s.SetAuditor(audit.New(events))
+
+	subjectToken, err := s.NewAccessToken(ctx, "alice", time.Minute, auth.WithScope("profile"))
+	require.NoError(t, err)
+
+	req := oauth.TokenRequest{
+		GrantType:        oauth.GrantTokenExchange,
+		Client:           oauth.ClientCredentials{ID: "gateway", Secret: testSecret, Method: oauth.AuthMethodBasic},
+		SubjectToken:     subjectToken,
+		SubjectTokenType: oauth.TokenTypeIDAccessToken,
+		Audience:         "billing",
+	}
+
+	resp, err := o.tokenExchange(ctx, req)
+	require.NoError(t, err)
+
+	claims, err := s.verifyIssuedToken(ctx, resp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "alice", claims.Subject)
+	require.Equal(t, "gateway", claims.ImpersonatedBy)
+	require.Nil(t, claims.Act)
+
+	// Delegation is not in the policy, but is audited all the same.
+	req.ActorToken = subjectToken
+	req.ActorTokenType = oauth.TokenTypeIDAccessToken
+	_, err = o.tokenExchange(ctx, req)
+	require.Error(t, err)
+
+	require.Len(t, *events, 2)
+	require.Equal(t, audit.TokenExchange, (*events)[0].Type)
+	require.Equal(t, "gateway", (*events)[0].Actor)
+	require.Equal(t, "alice", (*events)[0].Subject)
+	require.Equal(t, "impersonation", (*events)[0].Reason)
+	require.Equal(t, audit.Success, (*events)[0].Outcome)
+	require.Equal(t, "delegation", (*events)[1].Reason)
+	require.Equal(t, audit.Failure, (*events)[1].Outcome)
+}
+
+func TestExchangedTokenIsForItsAudience(t *testing.T) {
+	ctx := context.Background()
+	s, o, _ := newTestService(t)
+
+	subjectToken, err := s.NewAccessToken(ctx, "alice", time.Minute)
+	require.NoError(t, err)
+
+	creds := oauth.ClientCredentials{ID: "gateway", Secret: testSecret, Method: oauth.AuthMethodBasic}
+
+	resp, err := o.tokenExchange(ctx, oauth.TokenRequest{
+		GrantType:        oauth.GrantTokenExchange,
+		Client:           creds,
+		SubjectToken:     subjectToken,
+		SubjectTokenType: oauth.TokenTypeIDAccessToken,
+		Audience:         "billing",
+	})
+	require.NoError(t, err)
+
+	_, err = s.VerifyAccessToken(ctx, resp.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	introspection, err := o.Introspect(ctx, creds, resp.AccessToken, "")
+	require.NoError(t, err)
+	require.True(t, introspection.Active)
+}
+
+// roleStore is an in-memory RoleStorage.
+type roleStore struct {
+	roles       map[string]models.Role
+	assignments map[string][]string
+}
+
+func (s *roleStore) SaveRole(_ context.Context, role models.Role) error {
+	s.roles[role.Name] = role
+	return nil
+}
+
+func (s *roleStore) GetRole(_ context.Context, name string) (models.Role, error) {
+	role, ok := s.roles[name]
+	if !ok {
+		return models.Role{}, storage.ErrNotFound
+	}
+
+	return role, nil
+}
+
+func (s *roleStore) GetRoles(_ context.Context, names []string) ([]models.Role, error) {
+	roles := []models.Role{}
+	for _, name := range names {
+		if role, ok := s.roles[name]; ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, nil
+}
+
+func (s *roleStore) DeleteRole(_ context.Context, name string) error {
+	delete(s.roles, name)
+	return nil
+}
+
+func (s *roleStore) GetUserRoles(_ context.Context, userName string) ([]string, error) {
+	return s.assignments[userName], nil
+}
+
+func (s *roleStore) AssignRole(_ context.Context, userName string, role string) error {
+	s.assignments[userName] = append(s.assignments[userName], role)
+	return nil
+}
+
+func (s *roleStore) UnassignRole(_ context.Context, userName string, role string) error {
+	kept := []string{}
+	for _, r := range s.assignments[userName] {
+		if r != role {
+			kept = append(kept, r)
+		}
+	}
+
+	s.assignments[userName] = kept
+	return nil
+}
+
+func TestUserTokensCarryNoRoles(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestService(t)
+
+	roles := &roleStore{roles: map[string]models.Role{}, assignments: map[string][]string{}}
+	rbac, err := NewRBAC(roles)
+	require.NoError(t, err)
+	require.NoError(t, rbac.SaveRole(ctx, models.Role{Name: "admin", Permissions: []string{"rbac:*"}}))
+	require.ErrorIs(t, rbac.AssignRole(ctx, "admin", "admin"), ErrInvalidRole)
+	require.NoError(t, roles.AssignRole(ctx, "admin", "admin"))
+	require.NoError(t, rbac.AssignRole(ctx, ClientSubject("billing"), "admin"))
+	s.AddClaimsEnricher(rbac.Claims)
+
+	// /auth issues tokens for any name, so a role assigned to the name must
+	// not end up in them.
+	require.NoError(t, s.InsertToken(ctx, "refresh", "admin"))
+	accessToken, err := s.GetAccessToken(ctx, "admin")
+	require.NoError(t, err)
+
+	claims, err := s.VerifyAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+	require.Empty(t, claims.Roles)
+	require.Empty(t, claims.Permissions)
+
+	clientToken, err := s.NewClientAccessToken(ctx, "billing", time.Minute)
+	require.NoError(t, err)
+
+	claims, err = s.VerifyAccessToken(ctx, clientToken)
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin"}, claims.Roles)
+	require.Equal(t, []string{"rbac:*"}, claims.Permissions)
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/sl"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/exp/slog"
+)
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the endpoint secret, prefixed with "sha256=".
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookStorage stores deliveries. SaveDelivery fails with
+// storage.ErrConflict once another owner has claimed the delivery, and
+// ClaimDelivery with storage.ErrNotFound while another owner's lease lasts.
+type WebhookStorage interface {
+	SaveDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	PendingDeliveries(ctx context.Context) ([]models.WebhookDelivery, error)
+	ClaimDelivery(ctx context.Context, id string, owner string, leaseUntil time.Time) (models.WebhookDelivery, error)
+	DeadLetter(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// Webhooks posts events to the configured endpoints. Each delivery runs in
+// its own goroutine and is retried with exponential backoff. Every attempt
+// updates the stored delivery and renews this instance's lease on it, and
+// deliveries that run out of attempts go to the dead-letter store.
+// Deliveries left pending by Close, or by an instance that died, are picked
+// up again by Resume once their lease runs out. The work on a delivery is
+// logged to log, with the ID of the request the event was published in.
+type Webhooks struct {
+	cfg     config.Webhooks
+	storage WebhookStorage
+	client  *http.Client
+	log     *slog.Logger
+	owner   string
+
+	// mu makes starting a delivery and closing done mutually exclusive, so
+	// that wg.Add never races with Close's wg.Wait.
+	mu   sync.Mutex
+	wg   sync.WaitGroup
+	done chan struct{}
+	once sync.Once
+}
+
+func NewWebhooks(cfg config.Webhooks, storage WebhookStorage, log *slog.Logger) *Webhooks {
+	return &Webhooks{
+		cfg:     cfg,
+		storage: storage,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		log:     log,
+		owner:   primitive.NewObjectID().Hex(),
+		done:    make(chan struct{}),
+	}
+}
+
+// Handle starts a delivery of event to every endpoint subscribed to it. It is
+// meant to be subscribed to an EventBus, and leaves storing the deliveries to
+// their goroutines.
+func (w *Webhooks) Handle(ctx context.Context, event Event) {
+	const op = "service.Webhooks.Handle"
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logctx.FromContext(ctx).Error("failed to encode webhook event", slog.String("op", op), sl.Err(err))
+		return
+	}
+
+	for _, endpoint := range w.cfg.Endpoints {
+		if len(endpoint.Events) > 0 && !containsString(endpoint.Events, event.Type) {
+			continue
+		}
+
+		now := time.Now().UTC()
+		delivery := models.WebhookDelivery{
+			ID:          primitive.NewObjectID().Hex(),
+			EventID:     event.ID,
+			EventType:   event.Type,
+			URL:         endpoint.URL,
+			Payload:     string(payload),
+			RequestID:   logctx.RequestID(ctx),
+			Status:      models.WebhookPending,
+			Owner:       w.owner,
+			CreatedTime: now,
+			UpdatedTime: now,
+		}
+
+		w.start(endpoint, delivery)
+	}
+}
+
+// Resume claims the pending deliveries no other instance holds a lease on,
+// such as those left by the Close of a previous run, restarts them and
+// returns how many there were. Until Close it goes on claiming deliveries
+// whose lease runs out every Lease. Attempts so far count towards
+// MaxAttempts. A delivery to an endpoint that is no longer configured goes to
+// the dead-letter store. Receivers may see an event again if it was in
+// flight, and can tell by its X-Webhook-ID.
+func (w *Webhooks) Resume(ctx context.Context) (int, error) {
+	const op = "service.Webhooks.Resume"
+
+	if w == nil {
+		return 0, nil
+	}
+
+	claimed, err := w.claimPending(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	w.spawn(w.sweep)
+
+	return claimed, nil
+}
+
+// sweep claims deliveries abandoned by other instances until Close.
+func (w *Webhooks) sweep() {
+	ticker := time.NewTicker(w.cfg.Lease)
+	defer ticker.Stop()
+
+	ctx := logctx.NewContext(context.Background(), w.log)
+
+	for {
+		select {
+		case <-ticker.C:
+			if claimed, err := w.claimPending(ctx); err != nil {
+				logctx.FromContext(ctx).Error("failed to claim webhook deliveries", sl.Err(err))
+			} else if claimed > 0 {
+				logctx.FromContext(ctx).Info("resumed webhook deliveries", slog.Int("count", claimed))
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Webhooks) claimPending(ctx context.Context) (int, error) {
+	const op = "service.Webhooks.claimPending"
+
+	pending, err := w.storage.PendingDeliveries(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claimed := 0
+	for _, delivery := range pending {
+		// Ours are already running.
+		if delivery.Owner == w.owner {
+			continue
+		}
+
+		delivery, err := w.storage.ClaimDelivery(ctx, delivery.ID, w.owner, w.leaseUntil(delivery))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return claimed, fmt.Errorf("%s: %w", op, err)
+		}
+
+		claimed++
+
+		endpoint, ok := w.endpoint(delivery.URL)
+		if !ok {
+			delivery.Status = models.WebhookFailed
+			delivery.LastError = "endpoint is no longer configured"
+			delivery.UpdatedTime = time.Now().UTC()
+			w.save(w.context(delivery), delivery)
+
+			if err := w.storage.DeadLetter(ctx, delivery); err != nil {
+				return claimed, fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+
+		w.start(endpoint, delivery)
+	}
+
+	return claimed, nil
+}
+
+// Close stops waiting for retries and returns once the attempts in flight
+// are done. Deliveries still waiting, and those of events handled after
+// Close, stay pending in the storage with their lease given up, for Resume.
+func (w *Webhooks) Close() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	w.once.Do(func() { close(w.done) })
+	w.mu.Unlock()
+
+	w.wg.Wait()
+}
+
+// start delivers in the background. Once the Webhooks are closed, the
+// delivery is only stored, for another instance to claim.
+func (w *Webhooks) start(endpoint config.WebhookEndpoint, delivery models.WebhookDelivery) {
+	ctx := w.context(delivery)
+
+	if !w.spawn(func() { w.deliver(ctx, endpoint, delivery) }) {
+		w.release(ctx, delivery)
+	}
+}
+
+// context is the context the work on delivery is done and logged in.
+func (w *Webhooks) context(delivery models.WebhookDelivery) context.Context {
+	ctx := logctx.NewContext(context.Background(), w.log)
+	if delivery.RequestID != "" {
+		ctx = logctx.WithRequestID(ctx, delivery.RequestID)
+	}
+
+	return ctx
+}
+
+// spawn runs f in the background unless the Webhooks are closed.
+func (w *Webhooks) spawn(f func()) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		f()
+	}()
+
+	return true
+}
+
+func (w *Webhooks) endpoint(url string) (config.WebhookEndpoint, bool) {
+	for _, endpoint := range w.cfg.Endpoints {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+
+	return config.WebhookEndpoint{}, false
+}
+
+func (w *Webhooks) deliver(ctx context.Context, endpoint config.WebhookEndpoint, delivery models.WebhookDelivery) {
+	log := logctx.FromContext(ctx).With(slog.String("id", delivery.ID))
+
+	for {
+		if !w.save(ctx, delivery) {
+			return
+		}
+
+		// Resumed deliveries wait out the backoff they were in.
+		if wait := time.Until(delivery.NextAttemptAt); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.done:
+				w.release(ctx, delivery)
+				return
+			}
+		}
+
+		code, err := w.send(ctx, endpoint, delivery)
+
+		delivery.Attempts++
+		delivery.LastStatusCode = code
+		delivery.UpdatedTime = time.Now().UTC()
+		delivery.NextAttemptAt = time.Time{}
+
+		if err == nil {
+			delivery.Status = models.WebhookDelivered
+			delivery.LastError = ""
+			w.save(ctx, delivery)
+			return
+		}
+
+		delivery.LastError = err.Error()
+
+		if delivery.Attempts >= w.cfg.MaxAttempts {
+			delivery.Status = models.WebhookFailed
+			w.save(ctx, delivery)
+
+			if err := w.storage.DeadLetter(ctx, delivery); err != nil {
+				log.Error("failed to dead-letter webhook", sl.Err(err))
+			}
+
+			log.Warn("webhook delivery failed",
+				slog.String("url", delivery.URL),
+				slog.Int("attempts", delivery.Attempts),
+				sl.Err(err),
+			)
+
+			return
+		}
+
+		delivery.NextAttemptAt = delivery.UpdatedTime.Add(w.backoff(delivery.Attempts))
+	}
+}
+
+// leaseUntil is when the lease on a delivery runs out: Lease after its next
+// attempt may have timed out.
+func (w *Webhooks) leaseUntil(delivery models.WebhookDelivery) time.Time {
+	from := time.Now().UTC()
+	if delivery.NextAttemptAt.After(from) {
+		from = delivery.NextAttemptAt
+	}
+
+	return from.Add(w.cfg.Timeout + w.cfg.Lease)
+}
+
+// backoff is how long to wait after the given number of failed attempts.
+func (w *Webhooks) backoff(attempts int) time.Duration {
+	wait := w.cfg.Backoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if w.cfg.MaxBackoff > 0 && wait >= w.cfg.MaxBackoff {
+			return w.cfg.MaxBackoff
+		}
+	}
+
+	return wait
+}
+
+// send makes one attempt and returns the response status, if there was one.
+// Any status other than 2xx is an error.
+func (w *Webhooks) send(ctx context.Context, endpoint config.WebhookEndpoint, delivery models.WebhookDelivery) (int, error) {
+	const op = "service.Webhooks.send"
+
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, delivery.EventID)
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// save stores delivery and, while it is pending, renews the lease on it. It
+// reports false if another instance has claimed the delivery in the meantime.
+func (w *Webhooks) save(ctx context.Context, delivery models.WebhookDelivery) bool {
+	delivery.LeaseUntil = time.Time{}
+	if delivery.Status == models.WebhookPending {
+		delivery.LeaseUntil = w.leaseUntil(delivery)
+	}
+
+	return w.store(ctx, delivery)
+}
+
+// release stores a pending delivery with its lease given up.
+func (w *Webhooks) release(ctx context.Context, delivery models.WebhookDelivery) {
+	delivery.LeaseUntil = time.Now().UTC()
+	w.store(ctx, delivery)
+}
+
+func (w *Webhooks) store(ctx context.Context, delivery models.WebhookDelivery) bool {
+	err := w.storage.SaveDelivery(ctx, delivery)
+	if errors.Is(err, storage.ErrConflict) {
+		logctx.FromContext(ctx).Warn("webhook delivery was claimed by another instance", slog.String("id", delivery.ID))
+		return false
+	}
+	if err != nil {
+		logctx.FromContext(ctx).Error("failed to save webhook delivery", slog.String("id", delivery.ID), sl.Err(err))
+	}
+
+	return true
+}
+
+// SignWebhook returns the signature header value of a webhook body sent at
+// timestamp, for receivers to compare against.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/ZiganshinDev/medods/internal/lib/logger/logctx"
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type webhookStore struct {
+	mu          sync.Mutex
+	deliveries  map[string]models.WebhookDelivery
+	deadLetters []models.WebhookDelivery
+}
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{deliveries: map[string]models.WebhookDelivery{}}
+}
+
+func (s *webhookStore) SaveDelivery(_ context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.deliveries[d.ID]; ok && old.Owner != d.Owner {
+		return storage.ErrConflict
+	}
+
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *webhookStore) ClaimDelivery(_ context.Context, id string, owner string, leaseUntil time.Time) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok || d.Status != models.WebhookPending || (d.Owner != "" && d.LeaseUntil.After(time.Now())) {
+		return models.WebhookDelivery{}, storage.ErrNotFound
+	}
+
+	d.Owner = owner
+	d.LeaseUntil = leaseUntil
+	s.deliveries[id] = d
+
+	return d, nil
+}
+
+func (s *webhookStore) PendingDeliveries(_ context.Context) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := []models.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.Status == models.WebhookPending {
+			pending = append(pending, d)
+		}
+	}
+
+	return pending, nil
+}
+
+func (s *webhookStore) DeadLetter(_ context.Context, d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLetters = append(s.deadLetters, d)
+	return nil
+}
+
+func (s *webhookStore) statuses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var statuses []string
+	for _, d := range s.deliveries {
+		statuses = append(statuses, d.Status)
+	}
+
+	return statuses
+}
+
+func (s *webhookStore) only(t *testing.T) models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	require.Len(t, s.deliveries, 1)
+	for _, d := range s.deliveries {
+		return d
+	}
+
+	return models.WebhookDelivery{}
+}
+
+func webhooksConfig(url string) config.Webhooks {
+	return config.Webhooks{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		Lease:       time.Minute,
+		Endpoints: []config.WebhookEndpoint{
+			{URL: url, Secret: "secret", Events: []string{EventSessionRevoked}},
+		},
+	}
+}
+
+func TestWebhooksRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		received Event
+	)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		want := SignWebhook("secret", r.Header.Get(WebhookTimestampHeader), body)
+		if r.Header.Get(WebhookSignatureHeader) != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer receiver.Close()
+
+	store := newWebhookStore()
+	webhooks := NewWebhooks(webhooksConfig(receiver.URL), store, slog.Default())
+
+	bus := NewEventBus()
+	bus.Subscribe(webhooks.Handle)
+
+	bus.Publish(context.Background(), Event{Type: EventUserLoggedIn, Subject: "alice"})
+	bus.Publish(context.Background(), Event{Type: EventSessionRevoked, Subject: "alice", SessionID: "s1"})
+
+	require.Eventually(t, func() bool {
+		return reflect.DeepEqual(store.statuses(), []string{models.WebhookDelivered})
+	}, time.Second, 5*time.Millisecond)
+	webhooks.Close()
+
+	d := store.only(t)
+	require.Equal(t, 2, d.Attempts)
+	require.Equal(t, http.StatusOK, d.LastStatusCode)
+	require.Empty(t, store.deadLetters)
+
+	require.Equal(t, EventSessionRevoked, received.Type)
+	require.Equal(t, "s1", received.SessionID)
+	require.Equal(t, d.EventID, received.ID)
+}
+
+func TestWebhooksDeadLetter(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	var logs syncBuffer
+	store := newWebhookStore()
+	webhooks := NewWebhooks(webhooksConfig(receiver.URL), store, slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	webhooks.Handle(logctx.WithRequestID(context.Background(), "req-1"), Event{ID: "e1", Type: EventSessionRevoked})
+
+	require.Eventually(t, func() bool {
+		return reflect.DeepEqual(store.statuses(), []string{models.WebhookFailed})
+	}, time.Second, 5*time.Millisecond)
+	webhooks.Close()
+
+	d := store.only(t)
+	require.Equal(t, 3, d.Attempts)
+	require.Equal(t, http.StatusInternalServerError, d.LastStatusCode)
+	require.Len(t, store.deadLetters, 1)
+	require.Equal(t, "e1", store.deadLetters[0].EventID)
+
+	// The failure is logged with the request that published the event.
+	require.Equal(t, "req-1", d.RequestID)
+	require.Contains(t, logs.String(), `"msg":"webhook delivery failed"`)
+	require.Contains(t, logs.String(), `"request_id":"req-1"`)
+}
+
+// syncBuffer is a bytes.Buffer that delivery goroutines can log to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestWebhooksResume(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, r.Header.Get(WebhookIDHeader))
+	}))
+	defer receiver.Close()
+
+	store := newWebhookStore()
+
+	// Closed before the event, as on shutdown: the delivery is kept pending.
+	stopped := NewWebhooks(webhooksConfig(receiver.URL), store, slog.Default())
+	stopped.Close()
+	stopped.Handle(context.Background(), Event{ID: "e1", Type: EventSessionRevoked})
+	require.Equal(t, []string{models.WebhookPending}, store.statuses())
+
+	require.NoError(t, store.SaveDelivery(context.Background(), models.WebhookDelivery{
+		ID:      "removed",
+		URL:     "http://removed.example.com",
+		Status:  models.WebhookPending,
+		EventID: "e2",
+	}))
+
+	webhooks := NewWebhooks(webhooksConfig(receiver.URL), store, slog.Default())
+	resumed, err := webhooks.Resume(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, resumed)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return reflect.DeepEqual(received, []string{"e1"})
+	}, time.Second, 5*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		statuses := store.statuses()
+		sort.Strings(statuses)
+		return reflect.DeepEqual(statuses, []string{models.WebhookDelivered, models.WebhookFailed})
+	}, time.Second, 5*time.Millisecond)
+	webhooks.Close()
+
+	require.Len(t, store.deadLetters, 1)
+	require.Equal(t, "e2", store.deadLetters[0].EventID)
+}
+
+func TestWebhooksHandleDuringClose(t *testing.T) {
+	store := newWebhookStore()
+	webhooks := NewWebhooks(webhooksConfig("http://127.0.0.1:0"), store, slog.Default())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			webhooks.Handle(context.Background(), Event{Type: EventSessionRevoked})
+		}()
+	}
+
+	webhooks.Close()
+	wg.Wait()
+}
+
+func TestWebhooksResumeSkipsLeased(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	store := newWebhookStore()
+	for id, leaseUntil := range map[string]time.Time{
+		"held":    time.Now().Add(time.Hour),
+		"expired": time.Now().Add(-time.Second),
+	} {
+		require.NoError(t, store.SaveDelivery(context.Background(), models.WebhookDelivery{
+			ID:         id,
+			URL:        receiver.URL,
+			Status:     models.WebhookPending,
+			Owner:      "other",
+			LeaseUntil: leaseUntil,
+		}))
+	}
+
+	webhooks := NewWebhooks(webhooksConfig(receiver.URL), store, slog.Default())
+	resumed, err := webhooks.Resume(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, resumed)
+
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+
+		return store.deliveries["expired"].Status == models.WebhookDelivered
+	}, time.Second, 5*time.Millisecond)
+	webhooks.Close()
+
+	held := store.deliveries["held"]
+	require.Equal(t, models.WebhookPending, held.Status)
+	require.Equal(t, "other", held.Owner)
+	require.Zero(t, held.Attempts)
+}
+
+// slowWebhookStore holds every save until release is closed.
+type slowWebhookStore struct {
+	*webhookStore
+	release chan struct{}
+}
+
+func (s slowWebhookStore) SaveDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	<-s.release
+	return s.webhookStore.SaveDelivery(ctx, d)
+}
+
+func TestWebhooksHandleDoesNotWaitForStorage(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	store := slowWebhookStore{webhookStore: newWebhookStore(), release: make(chan struct{})}
+	webhooks := NewWebhooks(webhooksConfig(receiver.URL), store, slog.Default())
+
+	handled := make(chan struct{})
+	go func() {
+		webhooks.Handle(context.Background(), Event{ID: "e1", Type: EventSessionRevoked})
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("Handle waited for the storage")
+	}
+
+	close(store.release)
+
+	require.Eventually(t, func() bool {
+		return reflect.DeepEqual(store.statuses(), []string{models.WebhookDelivered})
+	}, time.Second, 5*time.Millisecond)
+	webhooks.Close()
+}
@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	auditEventsCollection = "audit_events"
+
+	// maxAuditEvents caps a single query.
+	maxAuditEvents = 1000
+)
+
+// AuditRepo is an audit sink that can also be queried. It never updates or
+// deletes events.
+type AuditRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewAuditRepo() *AuditRepo {
+	return &AuditRepo{
+		db: s.db.Collection(auditEventsCollection),
+	}
+}
+
+func (r *AuditRepo) Write(ctx context.Context, event models.AuditEvent) error {
+	const op = "storage.mongodb.AuditRepo.Write"
+
+	if _, err := r.db.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Query returns the events matching filter, newest first.
+func (r *AuditRepo) Query(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	const op = "storage.mongodb.AuditRepo.Query"
+
+	query := scoped(ctx, bson.M{})
+	if filter.Subject != "" {
+		query["subject"] = filter.Subject
+	}
+
+	period := bson.M{}
+	if !filter.From.IsZero() {
+		period["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		period["$lt"] = filter.To
+	}
+	if len(period) > 0 {
+		query["time"] = period
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditEvents {
+		limit = maxAuditEvents
+	}
+
+	cursor, err := r.db.Find(ctx, query, options.Find().SetSort(bson.M{"time": -1}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
@@ -2,47 +2,71 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/ZiganshinDev/medods/internal/metrics"
 	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"github.com/ZiganshinDev/medods/internal/tracing"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Storage struct {
-	db *mongo.Database
+	db      *mongo.Database
+	metrics *metrics.Metrics
 }
 
 func NewStorage(client *mongo.Client, database string) *Storage {
 	return &Storage{db: client.Database(database)}
 }
 
+// SetMetrics makes repos created afterwards record their latency to m.
+func (s *Storage) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
 type RefreshRepo struct {
-	db *mongo.Collection
+	db      *mongo.Collection
+	rotated *mongo.Collection
+	metrics *metrics.Metrics
 }
 
 const (
 	usersCollection = "users"
 	name            = "name"
 	rToken          = "refresh_token"
+	tokenID         = "token_id"
+	sessionClient   = "client_id"
 	createdTime     = "created_time"
+	tenantID        = "tenant_id"
 )
 
+// rotatedTokensCollection holds a models.RotatedToken per replaced refresh token.
+const rotatedTokensCollection = "rotated_tokens"
+
 func (s *Storage) NewRefreshRepo() *RefreshRepo {
 	return &RefreshRepo{
-		db: s.db.Collection(usersCollection),
+		db:      s.db.Collection(usersCollection),
+		rotated: s.db.Collection(rotatedTokensCollection),
+		metrics: s.metrics,
 	}
 }
 
-func (r *RefreshRepo) InsertToken(ctx context.Context, userName string, refreshToken string, timeNow time.Time) error {
+func (r *RefreshRepo) InsertToken(ctx context.Context, user models.Users) error {
 	const op = "storage.mongodb.InsertToken"
 
-	if _, err := r.db.InsertOne(ctx, models.Users{
-		Name:         userName,
-		RefreshToken: refreshToken,
-		CreatedTime:  timeNow,
-	}); err != nil {
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	if _, err := r.db.InsertOne(ctx, user); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -52,7 +76,12 @@ func (r *RefreshRepo) InsertToken(ctx context.Context, userName string, refreshT
 func (r *RefreshRepo) DeleteToken(ctx context.Context, refreshToken string) error {
 	const op = "storage.mongodb.DeleteToken"
 
-	filter := bson.M{rToken: refreshToken}
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{rToken: refreshToken})
 
 	if _, err := r.db.DeleteOne(ctx, filter); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -64,7 +93,31 @@ func (r *RefreshRepo) DeleteToken(ctx context.Context, refreshToken string) erro
 func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) error {
 	const op = "storage.mongodb.DeleteTokensByUser"
 
-	filter := bson.M{name: userName}
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{name: userName})
+
+	if _, err := r.db.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteTokensByClient deletes the sessions userName has with clientID, or
+// the first-party ones if clientID is empty.
+func (r *RefreshRepo) DeleteTokensByClient(ctx context.Context, userName string, clientID string) error {
+	const op = "storage.mongodb.DeleteTokensByClient"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{name: userName, sessionClient: clientFilter(clientID)})
 
 	if _, err := r.db.DeleteMany(ctx, filter); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -73,57 +126,175 @@ func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) e
 	return nil
 }
 
-func (r *RefreshRepo) SwitchToken(ctx context.Context, oldRefreshToken string, newRefreshToken string, userName string, timeNow time.Time) error {
+// SwitchToken replaces the session oldID with user. It fails with
+// storage.ErrConflict if oldID is already gone, so that a session can only be
+// replaced once.
+func (r *RefreshRepo) SwitchToken(ctx context.Context, oldID primitive.ObjectID, user models.Users) error {
 	const op = "storage.mongodb.SwitchToken"
 
-	if err := r.DeleteToken(ctx, oldRefreshToken); err != nil {
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	res, err := r.db.DeleteOne(ctx, scoped(ctx, bson.M{"_id": oldID}))
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := r.InsertToken(ctx, userName, newRefreshToken, timeNow); err != nil {
+	if res.DeletedCount != 1 {
+		return fmt.Errorf("%s: %w", op, storage.ErrConflict)
+	}
+
+	if err := r.InsertToken(ctx, user); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (int64, error) {
-	const op = "storage.mongodb.CountTokens"
+// GetSessionByUser returns the first-party session of userName.
+func (r *RefreshRepo) GetSessionByUser(ctx context.Context, userName string) (models.Users, error) {
+	const op = "storage.mongodb.GetSessionByUser"
 
-	filter := bson.M{name: userName}
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
-	count, err := r.db.CountDocuments(context.Background(), filter)
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{name: userName, sessionClient: clientFilter("")})
+
+	var user models.Users
+	err := r.db.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return count, nil
+	return user, nil
 }
 
-func (r *RefreshRepo) GetCreatedTime(ctx context.Context, refreshToken string, userName string) (time.Time, error) {
-	const op = "storage.mongodb.GetCreatedTime"
+func (r *RefreshRepo) GetByTokenID(ctx context.Context, id string) (models.Users, error) {
+	const op = "storage.mongodb.GetByTokenID"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
-	filter := bson.M{rToken: refreshToken, name: userName}
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{tokenID: id})
 
 	var user models.Users
 	err := r.db.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Users{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
 	if err != nil {
-		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+		return models.Users{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return user.CreatedTime, nil
+	return user, nil
 }
 
-func (r *RefreshRepo) GetTokenByUser(ctx context.Context, userName string) (string, error) {
-	const op = "storage.mongodb.GetTokenByUser"
+// InsertRotatedToken records that a refresh token has been rotated. The record
+// is removed once the token would have expired anyway.
+func (r *RefreshRepo) InsertRotatedToken(ctx context.Context, token models.RotatedToken) error {
+	const op = "storage.mongodb.InsertRotatedToken"
 
-	filter := bson.M{name: userName}
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
-	var user models.Users
-	err := r.db.FindOne(ctx, filter).Decode(&user)
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	if _, err := r.rotated.InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) GetRotatedToken(ctx context.Context, id string) (models.RotatedToken, error) {
+	const op = "storage.mongodb.GetRotatedToken"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	var token models.RotatedToken
+	err := r.rotated.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RotatedToken{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.RotatedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+func (r *RefreshRepo) ListTokensByUser(ctx context.Context, userName string) ([]models.Users, error) {
+	const op = "storage.mongodb.ListTokensByUser"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	filter := scoped(ctx, bson.M{name: userName})
+
+	cursor, err := r.db.Find(ctx, filter, options.Find().SetSort(bson.M{createdTime: -1}))
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users := []models.Users{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+func (r *RefreshRepo) DeleteTokenByID(ctx context.Context, userName string, id string) error {
+	const op = "storage.mongodb.DeleteTokenByID"
+
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	defer r.metrics.ObserveStorage(op, time.Now())
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	res, err := r.db.DeleteOne(ctx, scoped(ctx, bson.M{"_id": objectID, name: userName}))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+// clientFilter matches the sessions of clientID. First-party sessions have no
+// client_id, so an empty clientID matches documents without one.
+func clientFilter(clientID string) interface{} {
+	if clientID == "" {
+		return nil
+	}
+
+	return clientID
+}
+
+// scoped limits filter to the tenant in ctx. Outside of a tenant it is unchanged.
+func scoped(ctx context.Context, filter bson.M) bson.M {
+	if id := tenant.ID(ctx); id != "" {
+		filter[tenantID] = id
 	}
 
-	return user.RefreshToken, nil
+	return filter
 }
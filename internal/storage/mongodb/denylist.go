@@ -0,0 +1,51 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const revokedTokensCollection = "revoked_tokens"
+
+type DenylistRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewDenylistRepo() *DenylistRepo {
+	return &DenylistRepo{
+		db: s.db.Collection(revokedTokensCollection),
+	}
+}
+
+func (r *DenylistRepo) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.mongodb.Deny"
+
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{"$set": bson.M{"expires_at": expiresAt}}
+
+	if _, err := r.db.UpdateOne(ctx, bson.M{"_id": jti}, update, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *DenylistRepo) IsDenied(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.mongodb.IsDenied"
+
+	err := r.db.FindOne(ctx, bson.M{"_id": jti}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
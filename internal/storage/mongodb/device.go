@@ -0,0 +1,127 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const deviceCodesCollection = "device_codes"
+
+type DeviceRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewDeviceRepo() *DeviceRepo {
+	return &DeviceRepo{
+		db: s.db.Collection(deviceCodesCollection),
+	}
+}
+
+func (r *DeviceRepo) InsertDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const op = "storage.mongodb.InsertDeviceCode"
+
+	if _, err := r.db.InsertOne(ctx, code); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *DeviceRepo) GetDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const op = "storage.mongodb.GetDeviceCode"
+
+	code, err := r.findOne(ctx, bson.M{"_id": deviceCodeHash})
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+func (r *DeviceRepo) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "storage.mongodb.GetDeviceCodeByUserCode"
+
+	code, err := r.findOne(ctx, bson.M{"user_code": userCode})
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// RecordDevicePoll stores when a device code was polled and its interval. It
+// leaves the status alone, so it never undoes a concurrent approval.
+func (r *DeviceRepo) RecordDevicePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval int64) error {
+	const op = "storage.mongodb.RecordDevicePoll"
+
+	update := bson.M{"$set": bson.M{"last_polled_at": polledAt, "interval": interval}}
+
+	res, err := r.db.UpdateOne(ctx, bson.M{"_id": deviceCodeHash}, update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+// DecideDeviceCode stores the approval or denial of a code that is still
+// pending. It fails with storage.ErrConflict if the code was decided first.
+func (r *DeviceRepo) DecideDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const op = "storage.mongodb.DecideDeviceCode"
+
+	filter := bson.M{"_id": code.DeviceCodeHash, "status": models.DeviceCodePending}
+	update := bson.M{"$set": bson.M{"status": code.Status, "user_name": code.UserName, "auth_time": code.AuthTime}}
+
+	res, err := r.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrConflict)
+	}
+
+	return nil
+}
+
+// TakeApprovedDeviceCode removes an approved device code, so tokens are issued for it only once.
+func (r *DeviceRepo) TakeApprovedDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const op = "storage.mongodb.TakeApprovedDeviceCode"
+
+	filter := bson.M{"_id": deviceCodeHash, "status": models.DeviceCodeApproved}
+
+	var code models.DeviceCode
+	err := r.db.FindOneAndDelete(ctx, filter).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+func (r *DeviceRepo) findOne(ctx context.Context, filter bson.M) (models.DeviceCode, error) {
+	var code models.DeviceCode
+	err := r.db.FindOne(ctx, filter).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DeviceCode{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	return code, nil
+}
@@ -0,0 +1,38 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const dpopProofsCollection = "dpop_proofs"
+
+// DPoPRepo remembers DPoP proofs across instances so that a proof can only
+// be used once.
+type DPoPRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewDPoPRepo() *DPoPRepo {
+	return &DPoPRepo{
+		db: s.db.Collection(dpopProofsCollection),
+	}
+}
+
+func (r *DPoPRepo) Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	const op = "storage.mongodb.Remember"
+
+	_, err := r.db.InsertOne(ctx, bson.M{"_id": key, "expires_at": expiresAt})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const signingKeysCollection = "signing_keys"
+
+type KeyRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewKeyRepo() *KeyRepo {
+	return &KeyRepo{
+		db: s.db.Collection(signingKeysCollection),
+	}
+}
+
+func (r *KeyRepo) SaveKey(ctx context.Context, key models.SigningKey) error {
+	const op = "storage.mongodb.SaveKey"
+
+	if _, err := r.db.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetKeys returns the newest keys first.
+func (r *KeyRepo) GetKeys(ctx context.Context, limit int64) ([]models.SigningKey, error) {
+	const op = "storage.mongodb.GetKeys"
+
+	opts := options.Find().SetSort(bson.M{"created_time": -1}).SetLimit(limit)
+
+	cursor, err := r.db.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys := []models.SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
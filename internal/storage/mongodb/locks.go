@@ -0,0 +1,68 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const userLocksCollection = "user_locks"
+
+type LockRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewLockRepo() *LockRepo {
+	return &LockRepo{
+		db: s.db.Collection(userLocksCollection),
+	}
+}
+
+func (r *LockRepo) Lock(ctx context.Context, lock models.UserLock) error {
+	const op = "storage.mongodb.Lock"
+
+	filter := scoped(ctx, bson.M{"user_name": lock.UserName})
+	opts := options.Replace().SetUpsert(true)
+
+	if _, err := r.db.ReplaceOne(ctx, filter, lock, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *LockRepo) Unlock(ctx context.Context, userName string) error {
+	const op = "storage.mongodb.Unlock"
+
+	res, err := r.db.DeleteOne(ctx, scoped(ctx, bson.M{"user_name": userName}))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (r *LockRepo) GetLock(ctx context.Context, userName string) (models.UserLock, error) {
+	const op = "storage.mongodb.GetLock"
+
+	var lock models.UserLock
+	err := r.db.FindOne(ctx, scoped(ctx, bson.M{"user_name": userName})).Decode(&lock)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.UserLock{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.UserLock{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return lock, nil
+}
@@ -0,0 +1,83 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes are the indexes every collection needs. Documents with an
+// expires_at field are removed by Mongo shortly after they expire.
+var indexes = map[string][]mongo.IndexModel{
+	usersCollection: {
+		{Keys: bson.D{{Key: name, Value: 1}, {Key: tenantID, Value: 1}}},
+		{Keys: bson.D{{Key: tokenID, Value: 1}}},
+	},
+	rotatedTokensCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	rateLimitsCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	revokedTokensCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	dpopProofsCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	codesCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	deviceCodesCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "user_code", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	rolesCollection: {
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: tenantID, Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	userRolesCollection: {
+		{Keys: bson.D{{Key: "roles", Value: 1}}},
+		{Keys: bson.D{{Key: "user_name", Value: 1}, {Key: tenantID, Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	userLocksCollection: {
+		{Keys: bson.D{{Key: "user_name", Value: 1}, {Key: tenantID, Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	signingKeysCollection: {
+		{Keys: bson.D{{Key: "created_time", Value: -1}}},
+	},
+	auditEventsCollection: {
+		{Keys: bson.D{{Key: "subject", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+	},
+	webhookDeliveriesCollection: {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_time", Value: -1}}},
+		{Keys: bson.D{{Key: "event_id", Value: 1}}},
+	},
+	webhookDeadLettersCollection: {
+		{Keys: bson.D{{Key: "created_time", Value: -1}}},
+	},
+}
+
+// Migrate creates the indexes of all collections and returns their names.
+// Existing indexes are left as they are, so it is safe to run repeatedly.
+func (s *Storage) Migrate(ctx context.Context) ([]string, error) {
+	const op = "storage.mongodb.Migrate"
+
+	var created []string
+
+	for collection, idx := range indexes {
+		names, err := s.db.Collection(collection).Indexes().CreateMany(ctx, idx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, collection, err)
+		}
+
+		for _, n := range names {
+			created = append(created, collection+"."+n)
+		}
+	}
+
+	return created, nil
+}
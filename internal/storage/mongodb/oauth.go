@@ -0,0 +1,91 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	clientsCollection = "clients"
+	codesCollection   = "authorization_codes"
+)
+
+type ClientRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewClientRepo() *ClientRepo {
+	return &ClientRepo{
+		db: s.db.Collection(clientsCollection),
+	}
+}
+
+func (r *ClientRepo) GetClient(ctx context.Context, clientID string) (models.Client, error) {
+	const op = "storage.mongodb.GetClient"
+
+	var client models.Client
+	err := r.db.FindOne(ctx, bson.M{"_id": clientID}).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Client{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.Client{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, nil
+}
+
+func (r *ClientRepo) SaveClient(ctx context.Context, client models.Client) error {
+	const op = "storage.mongodb.SaveClient"
+
+	opts := options.Replace().SetUpsert(true)
+
+	if _, err := r.db.ReplaceOne(ctx, bson.M{"_id": client.ID}, client, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type CodeRepo struct {
+	db *mongo.Collection
+}
+
+func (s *Storage) NewCodeRepo() *CodeRepo {
+	return &CodeRepo{
+		db: s.db.Collection(codesCollection),
+	}
+}
+
+func (r *CodeRepo) InsertCode(ctx context.Context, code models.AuthorizationCode) error {
+	const op = "storage.mongodb.InsertCode"
+
+	if _, err := r.db.InsertOne(ctx, code); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeCode deletes the code while reading it, so a code can be redeemed only once.
+func (r *CodeRepo) TakeCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error) {
+	const op = "storage.mongodb.TakeCode"
+
+	var code models.AuthorizationCode
+	err := r.db.FindOneAndDelete(ctx, bson.M{"_id": codeHash}).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
@@ -0,0 +1,87 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const rateLimitsCollection = "rate_limits"
+
+type RateLimitRepo struct {
+	db *mongo.Collection
+}
+
+type rateLimitDocument struct {
+	Key       string                `bson:"_id"`
+	Version   int64                 `bson:"version"`
+	State     models.RateLimitState `bson:"state"`
+	ExpiresAt time.Time             `bson:"expires_at"`
+}
+
+func (s *Storage) NewRateLimitRepo() *RateLimitRepo {
+	return &RateLimitRepo{
+		db: s.db.Collection(rateLimitsCollection),
+	}
+}
+
+func (r *RateLimitRepo) Get(ctx context.Context, key string) (models.RateLimitState, int64, error) {
+	const op = "storage.mongodb.RateLimitRepo.Get"
+
+	var doc rateLimitDocument
+	err := r.db.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RateLimitState{}, 0, nil
+	}
+	if err != nil {
+		return models.RateLimitState{}, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if time.Now().After(doc.ExpiresAt) {
+		return models.RateLimitState{}, doc.Version, nil
+	}
+
+	return doc.State, doc.Version, nil
+}
+
+func (r *RateLimitRepo) CompareAndSwap(ctx context.Context, key string, version int64, state models.RateLimitState, ttl time.Duration) (bool, error) {
+	const op = "storage.mongodb.RateLimitRepo.CompareAndSwap"
+
+	expiresAt := time.Now().Add(ttl)
+
+	if version == 0 {
+		_, err := r.db.InsertOne(ctx, rateLimitDocument{
+			Key:       key,
+			Version:   1,
+			State:     state,
+			ExpiresAt: expiresAt,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return true, nil
+	}
+
+	res, err := r.db.UpdateOne(ctx,
+		bson.M{"_id": key, "version": version},
+		bson.M{"$set": bson.M{
+			"version":    version + 1,
+			"state":      state,
+			"expires_at": expiresAt,
+		}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res.MatchedCount == 1, nil
+}
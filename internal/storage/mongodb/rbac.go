@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"github.com/ZiganshinDev/medods/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	rolesCollection     = "roles"
+	userRolesCollection = "user_roles"
+)
+
+type RoleRepo struct {
+	roles     *mongo.Collection
+	userRoles *mongo.Collection
+}
+
+func (s *Storage) NewRoleRepo() *RoleRepo {
+	return &RoleRepo{
+		roles:     s.db.Collection(rolesCollection),
+		userRoles: s.db.Collection(userRolesCollection),
+	}
+}
+
+func (r *RoleRepo) SaveRole(ctx context.Context, role models.Role) error {
+	const op = "storage.mongodb.SaveRole"
+
+	role.TenantID = tenant.ID(ctx)
+	opts := options.Replace().SetUpsert(true)
+
+	if _, err := r.roles.ReplaceOne(ctx, inTenant(ctx, bson.M{"name": role.Name}), role, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RoleRepo) GetRole(ctx context.Context, name string) (models.Role, error) {
+	const op = "storage.mongodb.GetRole"
+
+	var role models.Role
+	err := r.roles.FindOne(ctx, inTenant(ctx, bson.M{"name": name})).Decode(&role)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return role, nil
+}
+
+// GetRoles returns the roles of the tenant in ctx with the given names, or all
+// of them if names is nil. Unknown names are skipped.
+func (r *RoleRepo) GetRoles(ctx context.Context, names []string) ([]models.Role, error) {
+	const op = "storage.mongodb.GetRoles"
+
+	filter := bson.M{}
+	if names != nil {
+		filter = bson.M{"name": bson.M{"$in": names}}
+	}
+
+	cursor, err := r.roles.Find(ctx, inTenant(ctx, filter), options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles := []models.Role{}
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// DeleteRole removes a role of the tenant in ctx and takes it away from every
+// user of the tenant that had it.
+func (r *RoleRepo) DeleteRole(ctx context.Context, name string) error {
+	const op = "storage.mongodb.DeleteRole"
+
+	res, err := r.roles.DeleteOne(ctx, inTenant(ctx, bson.M{"name": name}))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	update := bson.M{"$pull": bson.M{"roles": name}}
+	if _, err := r.userRoles.UpdateMany(ctx, inTenant(ctx, bson.M{"roles": name}), update); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetUserRoles returns the roles of a user in the tenant of ctx. Assignments,
+// like sessions, do not carry over to other tenants.
+func (r *RoleRepo) GetUserRoles(ctx context.Context, userName string) ([]string, error) {
+	const op = "storage.mongodb.GetUserRoles"
+
+	var userRoles models.UserRoles
+	err := r.userRoles.FindOne(ctx, inTenant(ctx, bson.M{"user_name": userName})).Decode(&userRoles)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userRoles.Roles, nil
+}
+
+func (r *RoleRepo) AssignRole(ctx context.Context, userName string, role string) error {
+	const op = "storage.mongodb.AssignRole"
+
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{"$addToSet": bson.M{"roles": role}}
+
+	if _, err := r.userRoles.UpdateOne(ctx, inTenant(ctx, bson.M{"user_name": userName}), update, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RoleRepo) UnassignRole(ctx context.Context, userName string, role string) error {
+	const op = "storage.mongodb.UnassignRole"
+
+	update := bson.M{"$pull": bson.M{"roles": role}}
+
+	res, err := r.userRoles.UpdateOne(ctx, inTenant(ctx, bson.M{"user_name": userName, "roles": role}), update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+// inTenant limits filter to the tenant in ctx. Unlike scoped, outside of a
+// tenant it matches only documents without one, so roles and assignments of a
+// tenant are never seen from another.
+func inTenant(ctx context.Context, filter bson.M) bson.M {
+	var id interface{}
+	if t := tenant.ID(ctx); t != "" {
+		id = t
+	}
+
+	filter[tenantID] = id
+
+	return filter
+}
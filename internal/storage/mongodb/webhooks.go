@@ -0,0 +1,114 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/models"
+	"github.com/ZiganshinDev/medods/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookDeliveriesCollection  = "webhook_deliveries"
+	webhookDeadLettersCollection = "webhook_dead_letters"
+)
+
+type WebhookRepo struct {
+	deliveries  *mongo.Collection
+	deadLetters *mongo.Collection
+}
+
+func (s *Storage) NewWebhookRepo() *WebhookRepo {
+	return &WebhookRepo{
+		deliveries:  s.db.Collection(webhookDeliveriesCollection),
+		deadLetters: s.db.Collection(webhookDeadLettersCollection),
+	}
+}
+
+// SaveDelivery stores the current status of a delivery. It fails with
+// storage.ErrConflict if the stored delivery has another owner by now.
+func (r *WebhookRepo) SaveDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	const op = "storage.mongodb.SaveDelivery"
+
+	// A delivery of another owner does not match, so the upsert collides
+	// with its _id.
+	filter := bson.M{"_id": delivery.ID, "owner": delivery.Owner}
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.deliveries.ReplaceOne(ctx, filter, delivery, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PendingDeliveries returns the deliveries that are neither delivered nor
+// failed, oldest first.
+func (r *WebhookRepo) PendingDeliveries(ctx context.Context) ([]models.WebhookDelivery, error) {
+	const op = "storage.mongodb.PendingDeliveries"
+
+	filter := bson.M{"status": models.WebhookPending}
+	cursor, err := r.deliveries.Find(ctx, filter, options.Find().SetSort(bson.M{"created_time": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery makes owner the owner of a pending delivery until leaseUntil.
+// It fails with storage.ErrNotFound if the delivery is no longer pending, or
+// another owner's lease on it has not run out.
+func (r *WebhookRepo) ClaimDelivery(ctx context.Context, id string, owner string, leaseUntil time.Time) (models.WebhookDelivery, error) {
+	const op = "storage.mongodb.ClaimDelivery"
+
+	filter := bson.M{
+		"_id":    id,
+		"status": models.WebhookPending,
+		"$or": bson.A{
+			bson.M{"owner": nil},
+			bson.M{"lease_until": nil},
+			bson.M{"lease_until": bson.M{"$lte": time.Now().UTC()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "lease_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var delivery models.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.WebhookDelivery{}, fmt.Errorf("%s: %w", op, storage.ErrNotFound)
+	}
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return delivery, nil
+}
+
+// DeadLetter keeps a delivery that ran out of attempts, so it can be
+// inspected and replayed by hand.
+func (r *WebhookRepo) DeadLetter(ctx context.Context, delivery models.WebhookDelivery) error {
+	const op = "storage.mongodb.DeadLetter"
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.deadLetters.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery, opts); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+)
+
+var (
+	ErrUnknownTenant = errors.New("unknown tenant")
+	ErrNoTenant      = errors.New("tenant is not specified")
+)
+
+type Tenant struct {
+	ID              string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(ctxKey{}).(Tenant)
+	return t, ok
+}
+
+// ID returns the ID of the tenant in ctx, or "" outside of a tenant.
+func ID(ctx context.Context) string {
+	t, _ := FromContext(ctx)
+	return t.ID
+}
+
+func AccessTokenTTL(ctx context.Context, def time.Duration) time.Duration {
+	if t, ok := FromContext(ctx); ok && t.AccessTokenTTL > 0 {
+		return t.AccessTokenTTL
+	}
+
+	return def
+}
+
+func RefreshTokenTTL(ctx context.Context, def time.Duration) time.Duration {
+	if t, ok := FromContext(ctx); ok && t.RefreshTokenTTL > 0 {
+		return t.RefreshTokenTTL
+	}
+
+	return def
+}
+
+// Registry resolves requests to the tenants declared in the config.
+type Registry struct {
+	header  string
+	def     string
+	tenants map[string]Tenant
+	hosts   map[string]string
+}
+
+func NewRegistry(cfg config.Tenancy) (*Registry, error) {
+	const op = "tenant.NewRegistry"
+
+	r := &Registry{
+		header:  cfg.Header,
+		def:     cfg.Default,
+		tenants: make(map[string]Tenant, len(cfg.Tenants)),
+		hosts:   make(map[string]string),
+	}
+
+	for _, tc := range cfg.Tenants {
+		if tc.ID == "" {
+			return nil, fmt.Errorf("%s: %w", op, errors.New("tenant without id"))
+		}
+
+		if _, ok := r.tenants[tc.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate tenant %s", op, tc.ID)
+		}
+
+		r.tenants[tc.ID] = Tenant{
+			ID:              tc.ID,
+			AccessTokenTTL:  tc.AccessTokenTTL,
+			RefreshTokenTTL: tc.RefreshTokenTTL,
+		}
+
+		for _, host := range tc.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := r.hosts[host]; ok {
+				return nil, fmt.Errorf("%s: host %s is used by %s and %s", op, host, other, tc.ID)
+			}
+			r.hosts[host] = tc.ID
+		}
+	}
+
+	if r.def != "" {
+		if _, ok := r.tenants[r.def]; !ok {
+			return nil, fmt.Errorf("%s: default: %w: %s", op, ErrUnknownTenant, r.def)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Registry) Header() string {
+	return r.header
+}
+
+func (r *Registry) Lookup(id string) (Tenant, bool) {
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+// Resolve finds the tenant of a request. An explicit tenant ID wins over the
+// host, and the default tenant is used when neither is known.
+func (r *Registry) Resolve(id string, host string) (Tenant, error) {
+	if id != "" {
+		t, ok := r.tenants[id]
+		if !ok {
+			return Tenant{}, fmt.Errorf("%w: %s", ErrUnknownTenant, id)
+		}
+		return t, nil
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if id, ok := r.hosts[strings.ToLower(host)]; ok {
+		return r.tenants[id], nil
+	}
+
+	if r.def != "" {
+		return r.tenants[r.def], nil
+	}
+
+	return Tenant{}, ErrNoTenant
+}
@@ -0,0 +1,79 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZiganshinDev/medods/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry(t *testing.T, def string) *Registry {
+	t.Helper()
+
+	r, err := NewRegistry(config.Tenancy{
+		Header:  "X-Tenant-ID",
+		Default: def,
+		Tenants: []config.Tenant{
+			{ID: "main", Hosts: []string{"auth.example.com"}},
+			{ID: "clinic", Hosts: []string{"Clinic.example.com"}, AccessTokenTTL: 5 * time.Minute},
+		},
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	r := newTestRegistry(t, "main")
+
+	tests := []struct {
+		id   string
+		host string
+		want string
+	}{
+		{host: "clinic.example.com:8080", want: "clinic"},
+		{host: "auth.example.com", want: "main"},
+		{id: "clinic", host: "auth.example.com", want: "clinic"},
+		{host: "unknown.example.com", want: "main"},
+	}
+
+	for _, tt := range tests {
+		got, err := r.Resolve(tt.id, tt.host)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got.ID)
+	}
+}
+
+func TestResolveError(t *testing.T) {
+	r := newTestRegistry(t, "")
+
+	_, err := r.Resolve("other", "auth.example.com")
+	require.ErrorIs(t, err, ErrUnknownTenant)
+
+	_, err = r.Resolve("", "unknown.example.com")
+	require.ErrorIs(t, err, ErrNoTenant)
+}
+
+func TestNewRegistryError(t *testing.T) {
+	_, err := NewRegistry(config.Tenancy{Tenants: []config.Tenant{
+		{ID: "a", Hosts: []string{"example.com"}},
+		{ID: "b", Hosts: []string{"example.com"}},
+	}})
+	require.Error(t, err)
+
+	_, err = NewRegistry(config.Tenancy{Default: "a"})
+	require.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestTTL(t *testing.T) {
+	r := newTestRegistry(t, "")
+
+	clinic, _ := r.Lookup("clinic")
+	ctx := NewContext(context.Background(), clinic)
+
+	require.Equal(t, 5*time.Minute, AccessTokenTTL(ctx, 15*time.Minute))
+	require.Equal(t, time.Hour, RefreshTokenTTL(ctx, time.Hour))
+	require.Equal(t, 15*time.Minute, AccessTokenTTL(context.Background(), 15*time.Minute))
+}